@@ -0,0 +1,231 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// ArchiveFormatJSON is the format for archives encoded as JSON.
+	ArchiveFormatJSON = "json"
+	// ArchiveFormatBinary is the format for archives encoded using a compact binary representation.
+	ArchiveFormatBinary = "binary"
+)
+
+// ArchiveVersion is the most recent version of the `Archive` format that this package can read and write. Version 2
+// introduced the tokenizer URI; version 1 archives are assumed to use a trigram tokenizer for their method.
+const ArchiveVersion = 2
+
+// ArchiveHeader records the parameters that were used to create an index so that archived indices can be
+// imported and searched using the same configuration.
+type ArchiveHeader struct {
+	// The version of the archive format
+	Version int `json:"version"`
+	// The trigram method used to tokenize documents, if a trigram tokenizer was used
+	Method string `json:"method"`
+	// The URI of the `Tokenizer` used to tokenize documents
+	Tokenizer string `json:"tokenizer,omitempty"`
+	// The maximum number of bytes read from each document
+	MaxBytes int64 `json:"max_bytes"`
+	// The number of bits in the bloom filter for each document
+	BloomSize int `json:"bloom_size"`
+	// The number of documents stored in each bloom filter block
+	DocumentsPerBlock int `json:"documents_per_block"`
+	// The names of the hash functions, in order, used to derive bloom filter positions for tokens
+	HashFunctions []string `json:"hash_functions"`
+	// The number of hash functions the index was configured with, which may be fewer than the number of hash functions if
+	// the index has a `TermTable`. If 0 it is assumed to be the number of hash functions
+	BloomHashes int `json:"bloom_hashes,omitempty"`
+	// The (optional) number of hash functions used for each token, if it depends on how common the token is
+	TermTable *TermTable `json:"term_table,omitempty"`
+	// Whether the index contains the trigrams spanning adjacent words used to pre-screen phrase queries
+	PhraseTrigrams bool `json:"phrase_trigrams"`
+	// The number of documents in the bloom filter, including documents added using `Index.Add` which don't have a file record
+	DocumentCount int `json:"document_count,omitempty"`
+}
+
+// IncompatibleArchiveError is the error returned when importing an archive whose parameters can not be honoured by this package.
+type IncompatibleArchiveError struct {
+	// The name of the archive header property that can not be honoured
+	Property string
+	// The value of that property in the archive
+	Value any
+}
+
+func (e *IncompatibleArchiveError) Error() string {
+	return fmt.Sprintf("Archive has an unsupported %s value (%v)", e.Property, e.Value)
+}
+
+// trigramMethods is the list of trigram methods that `NewTrigramTokenizer` understands.
+var trigramMethods = []string{
+	"default",
+	"merovius",
+	"dancantos",
+	"ffmiruz",
+	"jamesrom",
+}
+
+// hashFunctions returns the names of the first 'count' hash functions, in order, used by `HashBloomWithSize`.
+func hashFunctions(count int) []string {
+
+	names := []string{"fnv64a", "fnv64", "fnv64a+salt"}
+
+	for i := len(names); i < count; i++ {
+		names = append(names, fmt.Sprintf("fnv64a+%d*fnv64", i))
+	}
+
+	return names[:count]
+}
+
+// newArchiveHeader returns a new `ArchiveHeader` instance describing the configuration of 'idx'.
+func newArchiveHeader(idx *Index) *ArchiveHeader {
+
+	h := &ArchiveHeader{
+		Version:           ArchiveVersion,
+		Tokenizer:         idx.tokenizer.URI(),
+		MaxBytes:          idx.maxBytes,
+		BloomSize:         idx.bloomSize,
+		DocumentsPerBlock: DocumentsPerBlock,
+		HashFunctions:     hashFunctions(idx.bloomHashes),
+		BloomHashes:       idx.bloomHashes,
+		TermTable:         idx.termTable,
+		DocumentCount:     idx.currentDocumentCount,
+	}
+
+	if idx.termTable != nil && idx.termTable.maxHashes() > idx.bloomHashes {
+		h.HashFunctions = hashFunctions(idx.termTable.maxHashes())
+	}
+
+	if t, ok := idx.tokenizer.(*trigramTokenizer); ok {
+		h.Method = t.method
+		h.PhraseTrigrams = t.phrases
+	}
+
+	return h
+}
+
+// Validate ensures that the parameters in 'h' can be honoured by this package, returning an `IncompatibleArchiveError`
+// if not.
+func (h *ArchiveHeader) Validate() error {
+
+	if h.Version < 1 || h.Version > ArchiveVersion {
+		return &IncompatibleArchiveError{Property: "version", Value: h.Version}
+	}
+
+	if h.Tokenizer == "" && !slices.Contains(trigramMethods, h.Method) {
+		return &IncompatibleArchiveError{Property: "method", Value: h.Method}
+	}
+
+	if h.MaxBytes <= 0 {
+		return &IncompatibleArchiveError{Property: "max_bytes", Value: h.MaxBytes}
+	}
+
+	if h.BloomSize <= 0 {
+		return &IncompatibleArchiveError{Property: "bloom_size", Value: h.BloomSize}
+	}
+
+	if h.DocumentsPerBlock != DocumentsPerBlock {
+		return &IncompatibleArchiveError{Property: "documents_per_block", Value: h.DocumentsPerBlock}
+	}
+
+	if h.DocumentCount < 0 {
+		return &IncompatibleArchiveError{Property: "document_count", Value: h.DocumentCount}
+	}
+
+	count := len(h.HashFunctions)
+
+	if count == 0 || count > maxBloomHashes || !slices.Equal(h.HashFunctions, hashFunctions(count)) {
+		return &IncompatibleArchiveError{Property: "hash_functions", Value: h.HashFunctions}
+	}
+
+	if h.BloomHashes < 0 || h.BloomHashes > count {
+		return &IncompatibleArchiveError{Property: "bloom_hashes", Value: h.BloomHashes}
+	}
+
+	if h.TermTable != nil {
+
+		err := h.TermTable.validate(count)
+
+		if err != nil {
+			return &IncompatibleArchiveError{Property: "term_table", Value: err}
+		}
+	}
+
+	return nil
+}
+
+// validateData ensures that the documents in 'a' are consistent with the number of documents, 'count', and the number of
+// words in the bloom filter for each block, 'bloom_size', returning an `IncompatibleArchiveError` if not.
+func (a *Archive) validateData(count int, bloom_size int) error {
+
+	err := checkBloomFilterLength(len(a.BloomFilter), count, bloom_size)
+
+	if err != nil {
+		return &IncompatibleArchiveError{Property: "bloom_filter", Value: err}
+	}
+
+	for id, f := range a.IdToFile {
+
+		if f == nil {
+			return &IncompatibleArchiveError{Property: "id_to_file", Value: fmt.Sprintf("missing file record for document %d", id)}
+		}
+	}
+
+	for _, id := range a.Tombstones {
+
+		if int64(id) >= int64(count) {
+			return &IncompatibleArchiveError{Property: "tombstones", Value: fmt.Sprintf("document %d does not exist", id)}
+		}
+	}
+
+	return nil
+}
+
+// tokenizerForArchiveHeader returns the `Tokenizer` used to create the archive described by 'h'.
+func tokenizerForArchiveHeader(ctx context.Context, h *ArchiveHeader) (Tokenizer, error) {
+
+	if h.Tokenizer == "" {
+		return newTrigramTokenizer(h.Method, h.PhraseTrigrams), nil
+	}
+
+	t, err := NewTokenizer(ctx, h.Tokenizer)
+
+	if err != nil {
+		return nil, &IncompatibleArchiveError{Property: "tokenizer", Value: h.Tokenizer}
+	}
+
+	return t, nil
+}
+
+// withoutPhraseTokens returns a copy of 't' which does not produce the tokens spanning adjacent words, if it is
+// a trigram tokenizer, or 't' itself otherwise.
+func withoutPhraseTokens(t Tokenizer) Tokenizer {
+
+	tt, ok := t.(*trigramTokenizer)
+
+	if !ok {
+		return t
+	}
+
+	c := *tt
+	c.phrases = false
+
+	return &c
+}
+
+// archiveFormatForKey returns the archive format implied by the file extension of 'key' or 'default_format' if
+// there is no such format.
+func archiveFormatForKey(key string, default_format string) string {
+
+	switch strings.ToLower(filepath.Ext(key)) {
+	case ".json":
+		return ArchiveFormatJSON
+	case ".bin":
+		return ArchiveFormatBinary
+	default:
+		return default_format
+	}
+}
@@ -0,0 +1,420 @@
+package indexer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"time"
+)
+
+// The binary archive format is:
+//
+//	magic bytes ("IDXB")
+//	format version (uint16)
+//	length (uint32) prefixed JSON-encoded metadata (header, bucket URIs and tombstones)
+//	number of bloom filter words (uint64) followed by each word (uint64)
+//	number of files (uint32) followed by each file:
+//		bucket id (uint32)
+//		size (int64)
+//		modification time, as Unix nanoseconds (int64)
+//		length (uint16) prefixed MD5 hash
+//		length (uint32) prefixed path
+//	CRC-32 (IEEE) checksum of all the preceding bytes (uint32)
+//
+// All numbers are little-endian.
+
+// binaryArchiveMagic are the bytes that every binary archive starts with.
+var binaryArchiveMagic = []byte("IDXB")
+
+// binaryArchiveVersion is the version of the binary archive encoding.
+const binaryArchiveVersion uint16 = 1
+
+// binaryArchiveChunkSize is the maximum number of bloom filter words read at once when decoding a binary archive.
+const binaryArchiveChunkSize = 1 << 16
+
+// maxBinaryArchiveMD5Length is the maximum length of the MD5 hash of a file in a binary archive.
+const maxBinaryArchiveMD5Length = 64
+
+// maxBinaryArchivePathLength is the maximum length of the path of a file in a binary archive.
+const maxBinaryArchivePathLength = 1 << 16
+
+// binaryArchiveMetadata are the (small) properties of an `Archive` which are stored as JSON in a binary archive.
+type binaryArchiveMetadata struct {
+	Header     *ArchiveHeader    `json:"header,omitempty"`
+	BucketURIs map[string]uint32 `json:"bucket_uris"`
+	Tombstones []uint32          `json:"tombstones,omitempty"`
+}
+
+// isBinaryArchive reports whether 'r' contains a binary archive without consuming any data.
+func isBinaryArchive(r *bufio.Reader) bool {
+
+	magic, err := r.Peek(len(binaryArchiveMagic))
+
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(magic, binaryArchiveMagic)
+}
+
+// encodeBinaryArchive writes 'a' to 'wr' using the binary archive format.
+func encodeBinaryArchive(a *Archive, wr io.Writer) error {
+
+	buf := bufio.NewWriter(wr)
+	checksum := crc32.NewIEEE()
+
+	mw := io.MultiWriter(buf, checksum)
+
+	write := func(v any) error {
+		return binary.Write(mw, binary.LittleEndian, v)
+	}
+
+	_, err := mw.Write(binaryArchiveMagic)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write magic bytes, %w", err)
+	}
+
+	err = write(binaryArchiveVersion)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write version, %w", err)
+	}
+
+	md := &binaryArchiveMetadata{
+		Header:     a.Header,
+		BucketURIs: a.BucketURIs,
+		Tombstones: a.Tombstones,
+	}
+
+	enc_md, err := json.Marshal(md)
+
+	if err != nil {
+		return fmt.Errorf("Failed to encode metadata, %w", err)
+	}
+
+	err = write(uint32(len(enc_md)))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write metadata length, %w", err)
+	}
+
+	_, err = mw.Write(enc_md)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write metadata, %w", err)
+	}
+
+	err = write(uint64(len(a.BloomFilter)))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write bloom filter length, %w", err)
+	}
+
+	err = write(a.BloomFilter)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write bloom filter, %w", err)
+	}
+
+	err = write(uint32(len(a.IdToFile)))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write file count, %w", err)
+	}
+
+	for i, f := range a.IdToFile {
+
+		if f == nil {
+			return fmt.Errorf("Missing file record for file %d", i)
+		}
+
+		var md5 []byte
+
+		if f.MD5 != "" {
+
+			md5, err = hex.DecodeString(f.MD5)
+
+			if err != nil {
+				return fmt.Errorf("Failed to decode MD5 hash for file %d, %w", i, err)
+			}
+		}
+
+		if len(md5) > maxBinaryArchiveMD5Length {
+			return fmt.Errorf("MD5 hash for file %d is too long", i)
+		}
+
+		if len(f.Path) > maxBinaryArchivePathLength {
+			return fmt.Errorf("Path for file %d is too long", i)
+		}
+
+		var mod_time int64
+
+		if !f.ModTime.IsZero() {
+			mod_time = f.ModTime.UnixNano()
+		}
+
+		err = write(f.BucketId)
+
+		if err == nil {
+			err = write(f.Size)
+		}
+
+		if err == nil {
+			err = write(mod_time)
+		}
+
+		if err == nil {
+			err = write(uint16(len(md5)))
+		}
+
+		if err == nil {
+			_, err = mw.Write(md5)
+		}
+
+		if err == nil {
+			err = write(uint32(len(f.Path)))
+		}
+
+		if err == nil {
+			_, err = io.WriteString(mw, f.Path)
+		}
+
+		if err != nil {
+			return fmt.Errorf("Failed to write file %d, %w", i, err)
+		}
+	}
+
+	err = binary.Write(buf, binary.LittleEndian, checksum.Sum32())
+
+	if err != nil {
+		return fmt.Errorf("Failed to write checksum, %w", err)
+	}
+
+	return buf.Flush()
+}
+
+// decodeBinaryArchive reads an `Archive` encoded using the binary archive format from 'r'.
+func decodeBinaryArchive(r io.Reader) (*Archive, error) {
+
+	checksum := crc32.NewIEEE()
+	tr := io.TeeReader(r, checksum)
+
+	read := func(v any) error {
+		return binary.Read(tr, binary.LittleEndian, v)
+	}
+
+	magic := make([]byte, len(binaryArchiveMagic))
+
+	_, err := io.ReadFull(tr, magic)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read magic bytes, %w", err)
+	}
+
+	if !bytes.Equal(magic, binaryArchiveMagic) {
+		return nil, fmt.Errorf("Invalid magic bytes")
+	}
+
+	var version uint16
+
+	err = read(&version)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read version, %w", err)
+	}
+
+	if version != binaryArchiveVersion {
+		return nil, &IncompatibleArchiveError{Property: "binary version", Value: version}
+	}
+
+	var len_md uint32
+
+	err = read(&len_md)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read metadata length, %w", err)
+	}
+
+	enc_md, err := readBinaryArchiveBytes(tr, uint64(len_md))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read metadata, %w", err)
+	}
+
+	var md *binaryArchiveMetadata
+
+	err = json.Unmarshal(enc_md, &md)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode metadata, %w", err)
+	}
+
+	// metadata encoded as JSON null decodes without an error
+	if md == nil {
+		return nil, fmt.Errorf("Invalid metadata, archive may be corrupted")
+	}
+
+	var len_bloom uint64
+
+	err = read(&len_bloom)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read bloom filter length, %w", err)
+	}
+
+	// the bloom filter is read in chunks so that a corrupt length can't be used to allocate
+	// more memory than the archive actually contains
+
+	bloom_filter := make([]uint64, 0)
+
+	for remaining := len_bloom; remaining > 0; {
+
+		n := remaining
+
+		if n > binaryArchiveChunkSize {
+			n = binaryArchiveChunkSize
+		}
+
+		words := make([]uint64, n)
+
+		err = read(words)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read bloom filter, %w", err)
+		}
+
+		bloom_filter = append(bloom_filter, words...)
+		remaining -= n
+	}
+
+	var count_files uint32
+
+	err = read(&count_files)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read file count, %w", err)
+	}
+
+	// likewise files are appended as they are read rather than allocated up front
+	id_to_file := make([]*File, 0)
+
+	for i := uint32(0); i < count_files; i++ {
+
+		f := &File{}
+
+		var mod_time int64
+		var len_md5 uint16
+		var len_path uint32
+		var md5 []byte
+		var path []byte
+
+		err = read(&f.BucketId)
+
+		if err == nil {
+			err = read(&f.Size)
+		}
+
+		if err == nil {
+			err = read(&mod_time)
+		}
+
+		if err == nil {
+			err = read(&len_md5)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read file %d, %w", i, err)
+		}
+
+		if len_md5 > maxBinaryArchiveMD5Length {
+			return nil, fmt.Errorf("Invalid MD5 hash length (%d) for file %d", len_md5, i)
+		}
+
+		md5, err = readBinaryArchiveBytes(tr, uint64(len_md5))
+
+		if err == nil {
+			err = read(&len_path)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read file %d, %w", i, err)
+		}
+
+		if len_path > maxBinaryArchivePathLength {
+			return nil, fmt.Errorf("Invalid path length (%d) for file %d", len_path, i)
+		}
+
+		path, err = readBinaryArchiveBytes(tr, uint64(len_path))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read file %d, %w", i, err)
+		}
+
+		f.Path = string(path)
+
+		if mod_time != 0 {
+			f.ModTime = time.Unix(0, mod_time).UTC()
+		}
+
+		if len(md5) > 0 {
+			f.MD5 = hex.EncodeToString(md5)
+		}
+
+		id_to_file = append(id_to_file, f)
+	}
+
+	expected := checksum.Sum32()
+
+	var actual uint32
+
+	err = binary.Read(r, binary.LittleEndian, &actual)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read checksum, %w", err)
+	}
+
+	if actual != expected {
+		return nil, fmt.Errorf("Invalid checksum, archive may be corrupted")
+	}
+
+	a := &Archive{
+		Header:      md.Header,
+		BloomFilter: bloom_filter,
+		IdToFile:    id_to_file,
+		BucketURIs:  md.BucketURIs,
+		Tombstones:  md.Tombstones,
+	}
+
+	return a, nil
+}
+
+// readBinaryArchiveBytes reads exactly 'length' bytes from 'r'. The bytes are buffered as they are read, rather than
+// allocated up front, so that a corrupt length can't be used to allocate more memory than 'r' actually contains.
+func readBinaryArchiveBytes(r io.Reader, length uint64) ([]byte, error) {
+
+	if length > math.MaxInt64 {
+		return nil, fmt.Errorf("Invalid length (%d)", length)
+	}
+
+	var buf bytes.Buffer
+
+	_, err := io.CopyN(&buf, r, int64(length))
+
+	if errors.Is(err, io.EOF) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
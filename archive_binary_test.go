@@ -0,0 +1,315 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// binaryArchiveOffsets are the offsets of the length fields in a binary archive.
+type binaryArchiveOffsets struct {
+	metadataLength    int
+	bloomFilterLength int
+	fileCount         int
+	md5Length         int
+	pathLength        int
+}
+
+// newTestBinaryArchive returns a binary archive for a small index, containing files with MD5 hashes, and the offsets of its
+// length fields.
+func newTestBinaryArchive(t *testing.T) ([]byte, binaryArchiveOffsets) {
+
+	t.Helper()
+
+	idx, _ := newTestIndex(t, DefaultIndexOptions(), map[string]string{
+		"a.txt":     "hello world",
+		"b/c.txt":   "goodbye world",
+		"b/d/e.txt": "hello again",
+	})
+
+	a := idx.Archive()
+
+	for _, f := range a.IdToFile {
+		f.MD5 = "0123456789abcdef0123456789abcdef"
+	}
+
+	var buf bytes.Buffer
+
+	err := encodeBinaryArchive(a, &buf)
+
+	if err != nil {
+		t.Fatalf("Failed to encode binary archive, %v", err)
+	}
+
+	enc := buf.Bytes()
+
+	var o binaryArchiveOffsets
+
+	o.metadataLength = len(binaryArchiveMagic) + 2
+	o.bloomFilterLength = o.metadataLength + 4 + int(binary.LittleEndian.Uint32(enc[o.metadataLength:]))
+	o.fileCount = o.bloomFilterLength + 8 + 8*int(binary.LittleEndian.Uint64(enc[o.bloomFilterLength:]))
+	o.md5Length = o.fileCount + 4 + 4 + 8 + 8
+	o.pathLength = o.md5Length + 2 + int(binary.LittleEndian.Uint16(enc[o.md5Length:]))
+
+	return enc, o
+}
+
+// equalArchives reports whether 'a' and 'b' contain the same data.
+func equalArchives(t *testing.T, a *Archive, b *Archive) bool {
+
+	t.Helper()
+
+	enc_a, err := json.Marshal(a.Header)
+
+	if err != nil {
+		t.Fatalf("Failed to encode header, %v", err)
+	}
+
+	enc_b, err := json.Marshal(b.Header)
+
+	if err != nil {
+		t.Fatalf("Failed to encode header, %v", err)
+	}
+
+	if !bytes.Equal(enc_a, enc_b) {
+		return false
+	}
+
+	if !slices.Equal(a.BloomFilter, b.BloomFilter) || !slices.Equal(a.Tombstones, b.Tombstones) {
+		return false
+	}
+
+	if len(a.BucketURIs) != len(b.BucketURIs) {
+		return false
+	}
+
+	for uri, id := range a.BucketURIs {
+
+		if b.BucketURIs[uri] != id {
+			return false
+		}
+	}
+
+	return slices.EqualFunc(a.IdToFile, b.IdToFile, func(f_a *File, f_b *File) bool {
+		return f_a.Path == f_b.Path && f_a.BucketId == f_b.BucketId && f_a.Size == f_b.Size && f_a.MD5 == f_b.MD5 && f_a.ModTime.Equal(f_b.ModTime)
+	})
+}
+
+func TestBinaryArchiveRoundTrip(t *testing.T) {
+
+	ctx := context.Background()
+
+	idx, _ := newTestIndex(t, DefaultIndexOptions(), map[string]string{
+		"a.txt":     "hello world",
+		"b/c.txt":   "goodbye world",
+		"b/d/e.txt": "hello again",
+	})
+
+	err := idx.Remove(1)
+
+	if err != nil {
+		t.Fatalf("Failed to remove document, %v", err)
+	}
+
+	expected := idx.Archive()
+
+	// JSON -> binary -> JSON
+
+	var json_buf bytes.Buffer
+
+	err = idx.ExportArchiveWithFormat(ctx, &json_buf, ArchiveFormatJSON)
+
+	if err != nil {
+		t.Fatalf("Failed to export JSON archive, %v", err)
+	}
+
+	from_json := NewIndex()
+
+	err = from_json.ImportArchive(ctx, &json_buf)
+
+	if err != nil {
+		t.Fatalf("Failed to import JSON archive, %v", err)
+	}
+
+	var binary_buf bytes.Buffer
+
+	err = from_json.ExportArchiveWithFormat(ctx, &binary_buf, ArchiveFormatBinary)
+
+	if err != nil {
+		t.Fatalf("Failed to export binary archive, %v", err)
+	}
+
+	if !bytes.HasPrefix(binary_buf.Bytes(), binaryArchiveMagic) {
+		t.Fatalf("Binary archive does not start with magic bytes")
+	}
+
+	from_binary := NewIndex()
+
+	err = from_binary.ImportArchive(ctx, &binary_buf)
+
+	if err != nil {
+		t.Fatalf("Failed to import binary archive, %v", err)
+	}
+
+	if !equalArchives(t, expected, from_json.Archive()) {
+		t.Fatalf("Archive imported from JSON does not match original")
+	}
+
+	if !equalArchives(t, expected, from_binary.Archive()) {
+		t.Fatalf("Archive imported from binary does not match original")
+	}
+
+	ids := from_binary.Search(from_binary.Queryise("hello"))
+
+	if !slices.Equal(ids, []uint32{0, 2}) {
+		t.Fatalf("Unexpected results for index imported from binary archive: %v", ids)
+	}
+}
+
+func TestBinaryArchiveChecksum(t *testing.T) {
+
+	enc, o := newTestBinaryArchive(t)
+
+	// flip a bit in the bloom filter, which doesn't change any lengths
+	enc[o.bloomFilterLength+8] ^= 1
+
+	_, err := decodeBinaryArchive(bytes.NewReader(enc))
+
+	if err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("Expected checksum error, got %v", err)
+	}
+}
+
+func TestBinaryArchiveMagicAndVersion(t *testing.T) {
+
+	enc, _ := newTestBinaryArchive(t)
+
+	bad_magic := slices.Clone(enc)
+	copy(bad_magic, "XXXX")
+
+	_, err := decodeBinaryArchive(bytes.NewReader(bad_magic))
+
+	if err == nil || !strings.Contains(err.Error(), "magic") {
+		t.Fatalf("Expected magic bytes error, got %v", err)
+	}
+
+	bad_version := slices.Clone(enc)
+	binary.LittleEndian.PutUint16(bad_version[len(binaryArchiveMagic):], binaryArchiveVersion+1)
+
+	_, err = decodeBinaryArchive(bytes.NewReader(bad_version))
+
+	var incompatible *IncompatibleArchiveError
+
+	if !errors.As(err, &incompatible) {
+		t.Fatalf("Expected IncompatibleArchiveError, got %v", err)
+	}
+
+	err = NewIndex().ImportArchive(context.Background(), bytes.NewReader(bad_version))
+
+	if !errors.As(err, &incompatible) {
+		t.Fatalf("Expected IncompatibleArchiveError importing archive, got %v", err)
+	}
+}
+
+func TestBinaryArchiveTruncated(t *testing.T) {
+
+	enc, _ := newTestBinaryArchive(t)
+
+	for i := 0; i < len(enc); i++ {
+
+		_, err := decodeBinaryArchive(bytes.NewReader(enc[:i]))
+
+		if err == nil {
+			t.Fatalf("Expected error decoding archive truncated to %d bytes", i)
+		}
+	}
+
+	_, err := decodeBinaryArchive(bytes.NewReader(enc))
+
+	if err != nil {
+		t.Fatalf("Failed to decode archive, %v", err)
+	}
+}
+
+func TestBinaryArchiveCorruptLengths(t *testing.T) {
+
+	enc, o := newTestBinaryArchive(t)
+
+	tests := map[string]func([]byte){
+		"metadata length": func(b []byte) {
+			binary.LittleEndian.PutUint32(b[o.metadataLength:], 1<<31)
+		},
+		"bloom filter length": func(b []byte) {
+			binary.LittleEndian.PutUint64(b[o.bloomFilterLength:], 1<<62)
+		},
+		"maximum bloom filter length": func(b []byte) {
+			binary.LittleEndian.PutUint64(b[o.bloomFilterLength:], 1<<64-1)
+		},
+		"file count": func(b []byte) {
+			binary.LittleEndian.PutUint32(b[o.fileCount:], 1<<31)
+		},
+		"MD5 length": func(b []byte) {
+			binary.LittleEndian.PutUint16(b[o.md5Length:], 1<<16-1)
+		},
+		"path length": func(b []byte) {
+			binary.LittleEndian.PutUint32(b[o.pathLength:], 1<<31)
+		},
+	}
+
+	for name, corrupt := range tests {
+
+		b := slices.Clone(enc)
+		corrupt(b)
+
+		err := NewIndex().ImportArchive(context.Background(), bytes.NewReader(b))
+
+		if err == nil {
+			t.Fatalf("Expected error importing archive with corrupt %s", name)
+		}
+	}
+}
+
+func TestBinaryArchiveNullMetadata(t *testing.T) {
+
+	enc, o := newTestBinaryArchive(t)
+
+	// replace the metadata with JSON null and update the checksum so that only the metadata is invalid
+
+	var buf bytes.Buffer
+
+	buf.Write(enc[:o.metadataLength])
+	binary.Write(&buf, binary.LittleEndian, uint32(4))
+	buf.WriteString("null")
+	buf.Write(enc[o.bloomFilterLength : len(enc)-4])
+	binary.Write(&buf, binary.LittleEndian, crc32.ChecksumIEEE(buf.Bytes()))
+
+	_, err := decodeBinaryArchive(bytes.NewReader(buf.Bytes()))
+
+	if err == nil || !strings.Contains(err.Error(), "metadata") {
+		t.Fatalf("Expected metadata error, got %v", err)
+	}
+}
+
+func TestBinaryArchiveMissingFileRecord(t *testing.T) {
+
+	idx, _ := newTestIndex(t, DefaultIndexOptions(), map[string]string{
+		"a.txt": "hello world",
+	})
+
+	a := idx.Archive()
+	a.IdToFile[0] = nil
+
+	var buf bytes.Buffer
+
+	err := encodeBinaryArchive(a, &buf)
+
+	if err == nil {
+		t.Fatalf("Expected error encoding archive with a missing file record")
+	}
+}
@@ -3,7 +3,11 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"runtime"
+	"strings"
 
 	"github.com/aaronland/go-indexer"
 	"github.com/sfomuseum/go-flags/multi"
@@ -15,20 +19,90 @@ func main() {
 	var bucket_uris multi.MultiString
 	var index_uri string
 
+	var include multi.MultiString
+	var exclude multi.MultiString
+	var ignore_files multi.MultiString
+	var no_ignore_files bool
+	var include_hidden bool
+	var workers int
+	var tokenizer_uri string
+	var bloom_size int
+	var bloom_hashes int
+	var adaptive_hashes bool
+	var stats bool
+	var measure_queries string
+
+	var update bool
+
 	flag.Var(&bucket_uris, "bucket-uri", "One or more valid gocloud.dev/blob bucket URIs to index. The URI 'cwd://` will be interpreted as the current working directory on the local disk.")
 	flag.StringVar(&index_uri, "index-uri", "cwd:///indexer.idx", "A valid gocloud.dev/blob bucket URIs containing the filename of the index to archive.")
 
+	flag.Var(&include, "include", "Zero or more (.gitignore style) glob patterns. If present only files matching at least one pattern will be indexed.")
+	flag.Var(&exclude, "exclude", "Zero or more (.gitignore style) glob patterns. Files and directories matching any pattern will not be indexed.")
+	flag.Var(&ignore_files, "ignore-file", "Zero or more file names whose (.gitignore style) rules will be honoured when they are encountered while indexing a bucket. If empty the defaults are '.gitignore' and '.ignore'.")
+	flag.BoolVar(&no_ignore_files, "no-ignore-files", false, "Do not honour any ignore files encountered while indexing a bucket.")
+	flag.BoolVar(&include_hidden, "include-hidden", false, "Index directories whose names start with '.' (for example '.git').")
+	flag.StringVar(&tokenizer_uri, "tokenizer-uri", "trigram://", "A valid tokenizer URI used to tokenize documents. Valid schemes are: "+strings.Join(indexer.TokenizerSchemes(), ", ")+".")
+	flag.IntVar(&bloom_size, "bloom-size", indexer.BloomSize, "The number of bits in the bloom filter for each document. Smaller values use less memory but yield more false positives.")
+	flag.IntVar(&bloom_hashes, "bloom-hashes", indexer.BloomHashes, "The number of hash functions used to derive the bloom filter positions for each token.")
+	flag.BoolVar(&adaptive_hashes, "adaptive-hashes", false, "Derive the number of hash functions used for each token from how common it is, hashing rare tokens more times and common tokens fewer times. This requires every document to be read twice. It has no effect when updating an index.")
+	flag.BoolVar(&stats, "stats", false, "Print statistics describing how full the bloom filter is and its estimated false positive rates once the index has been written.")
+	flag.StringVar(&measure_queries, "measure-queries", "", "The path of a file containing queries, one per line, used to measure how many of the candidate documents reported by the bloom filter fail verification once the index has been written. Empty lines and lines starting with '#' are ignored.")
+	flag.IntVar(&workers, "workers", runtime.NumCPU(), "The number of documents to read and tokenize concurrently while indexing a bucket.")
+
+	flag.BoolVar(&update, "update", false, "Load the existing index (archive) at -index-uri and only re-index the files in -bucket-uri that are new or have changed, writing the updated index back to -index-uri. If no -bucket-uri flags are present then all the buckets in the existing index will be updated.")
+
 	flag.Parse()
 
 	ctx := context.Background()
 
-	idx := indexer.NewIndex()
-	defer idx.Close()
+	opts := indexer.DefaultIndexOptions()
+	opts.Include = include
+	opts.Exclude = exclude
+	opts.IncludeHidden = include_hidden
+	opts.Workers = workers
+	opts.BloomSize = bloom_size
+	opts.BloomHashes = bloom_hashes
+	opts.AdaptiveHashes = adaptive_hashes
 
-	err := idx.IndexBuckets(ctx, bucket_uris...)
+	tokenizer, err := indexer.NewTokenizer(ctx, tokenizer_uri)
 
 	if err != nil {
-		log.Fatalf("Failed to index buckets, %v", err)
+		log.Fatalf("Failed to create tokenizer, %v", err)
+	}
+
+	opts.Tokenizer = tokenizer
+
+	if no_ignore_files {
+		opts.IgnoreFiles = []string{}
+	} else if len(ignore_files) > 0 {
+		opts.IgnoreFiles = ignore_files
+	}
+
+	idx := indexer.NewIndexWithOptions(opts)
+	defer idx.Close()
+
+	if update {
+
+		err := idx.ImportArchiveWithURI(ctx, index_uri)
+
+		if err != nil {
+			log.Fatalf("Failed to import index, %v", err)
+		}
+
+		err = idx.Update(ctx, bucket_uris...)
+
+		if err != nil {
+			log.Fatalf("Failed to update index, %v", err)
+		}
+
+	} else {
+
+		err := idx.IndexBuckets(ctx, bucket_uris...)
+
+		if err != nil {
+			log.Fatalf("Failed to index buckets, %v", err)
+		}
 	}
 
 	err = idx.ExportArchiveWithURI(ctx, index_uri)
@@ -36,4 +110,59 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to export index, %v", err)
 	}
+
+	if stats {
+
+		s := idx.Statistics()
+
+		fmt.Printf("documents: %d\n", s.Documents)
+		fmt.Printf("bloom size: %d\n", s.BloomSize)
+
+		if s.TermTableSize >= 0 {
+			fmt.Printf("term table: %d tokens\n", s.TermTableSize)
+		} else {
+			fmt.Printf("bloom hashes: %d\n", s.BloomHashes)
+		}
+
+		fmt.Printf("fill: %.2f%%\n", s.Fill*100)
+
+		for k := 1; k <= len(s.FalsePositiveRates); k++ {
+			fmt.Printf("estimated false positive rate (%d hashes): %.6f\n", k, s.FalsePositiveRates[k])
+		}
+
+		fmt.Printf("estimated false positive rate: %.6f\n", s.FalsePositiveRate)
+	}
+
+	if measure_queries != "" {
+
+		body, err := os.ReadFile(measure_queries)
+
+		if err != nil {
+			log.Fatalf("Failed to read queries, %v", err)
+		}
+
+		queries := make([]string, 0)
+
+		for _, q := range strings.Split(string(body), "\n") {
+
+			q = strings.TrimSpace(q)
+
+			if q == "" || strings.HasPrefix(q, "#") {
+				continue
+			}
+
+			queries = append(queries, q)
+		}
+
+		m, err := idx.MeasureFalsePositives(ctx, queries)
+
+		if err != nil {
+			log.Fatalf("Failed to measure false positives, %v", err)
+		}
+
+		fmt.Printf("queries: %d\n", m.Queries)
+		fmt.Printf("candidates: %d\n", m.Candidates)
+		fmt.Printf("matches: %d\n", m.Matches)
+		fmt.Printf("false positives: %d (%.2f%%)\n", m.FalsePositives(), m.Rate()*100)
+	}
 }
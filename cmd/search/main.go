@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
 	"fmt"
 	"log"
-	"log/slog"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
 
 	"github.com/aaronland/go-indexer"
 	"github.com/sfomuseum/go-flags/multi"
@@ -17,14 +21,88 @@ func main() {
 	var bucket_uris multi.MultiString
 	var index_uri string
 
+	var include multi.MultiString
+	var exclude multi.MultiString
+	var ignore_files multi.MultiString
+	var no_ignore_files bool
+	var include_hidden bool
+	var workers int
+	var tokenizer_uri string
+	var bloom_size int
+	var bloom_hashes int
+	var synonyms_uri string
+
+	var case_sensitive bool
+	var use_regexp bool
+	var max_results int
+	var max_matches int
+	var sort_by string
+
 	flag.Var(&bucket_uris, "bucket-uri", "One or more valid gocloud.dev/blob bucket URIs to index. The URI 'cwd://` will be interpreted as the current working directory on the local disk.")
 	flag.StringVar(&index_uri, "index-uri", "", "An optional valid gocloud.dev/blob bucket URIs containing the filename of the index (archive) to load (instead of indexing things from scratch). The URI scheme 'cwd://' will be interpreted as the current working directory on the local disk.")
 
+	flag.Var(&include, "include", "Zero or more (.gitignore style) glob patterns. If present only files matching at least one pattern will be indexed.")
+	flag.Var(&exclude, "exclude", "Zero or more (.gitignore style) glob patterns. Files and directories matching any pattern will not be indexed.")
+	flag.Var(&ignore_files, "ignore-file", "Zero or more file names whose (.gitignore style) rules will be honoured when they are encountered while indexing a bucket. If empty the defaults are '.gitignore' and '.ignore'.")
+	flag.BoolVar(&no_ignore_files, "no-ignore-files", false, "Do not honour any ignore files encountered while indexing a bucket.")
+	flag.BoolVar(&include_hidden, "include-hidden", false, "Index directories whose names start with '.' (for example '.git').")
+	flag.StringVar(&tokenizer_uri, "tokenizer-uri", "trigram://", "A valid tokenizer URI used to tokenize documents and queries when indexing buckets (imported indices use the tokenizer recorded in the archive). Valid schemes are: "+strings.Join(indexer.TokenizerSchemes(), ", ")+".")
+	flag.StringVar(&synonyms_uri, "synonyms-uri", "", "An optional path, or valid gocloud.dev/blob bucket URI, of a synonym dictionary whose terms and phrases will be expanded when searching. Each line in the dictionary is a comma-separated group of equivalent terms or phrases.")
+	flag.IntVar(&bloom_size, "bloom-size", indexer.BloomSize, "The number of bits in the bloom filter for each document when indexing buckets (imported indices use the value recorded in the archive). Smaller values use less memory but yield more false positives.")
+	flag.IntVar(&bloom_hashes, "bloom-hashes", indexer.BloomHashes, "The number of hash functions used to derive the bloom filter positions for each token when indexing buckets (imported indices use the value recorded in the archive).")
+	flag.IntVar(&workers, "workers", runtime.NumCPU(), "The number of documents to read and tokenize concurrently while indexing a bucket.")
+
+	flag.BoolVar(&case_sensitive, "case-sensitive", false, "Match quoted phrases and regular expressions case-sensitively.")
+	flag.IntVar(&max_results, "max-results", 0, "The maximum number of results to display for each search. If 0 all results are displayed.")
+	flag.IntVar(&max_matches, "max-matches", 5, "The maximum number of matching lines to display for each result. If 0 all matching lines are displayed.")
+	flag.StringVar(&sort_by, "sort", indexer.SortById, "The order in which results are displayed. Valid options are: id (the order in which documents were indexed), score (most relevant first).")
+	flag.BoolVar(&use_regexp, "regexp", false, "Treat each search as a (Go) regular expression which is matched against individual lines.")
+
 	flag.Parse()
 
+	switch sort_by {
+	case indexer.SortById, indexer.SortByScore:
+		// pass
+	default:
+		log.Fatalf("Invalid -sort flag, '%s'", sort_by)
+	}
+
 	ctx := context.Background()
 
-	idx := indexer.NewIndex()
+	opts := indexer.DefaultIndexOptions()
+	opts.Include = include
+	opts.Exclude = exclude
+	opts.IncludeHidden = include_hidden
+	opts.Workers = workers
+	opts.BloomSize = bloom_size
+	opts.BloomHashes = bloom_hashes
+
+	tokenizer, err := indexer.NewTokenizer(ctx, tokenizer_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to create tokenizer, %v", err)
+	}
+
+	opts.Tokenizer = tokenizer
+
+	if synonyms_uri != "" {
+
+		synonyms, err := indexer.ReadSynonymsWithURI(ctx, synonyms_uri)
+
+		if err != nil {
+			log.Fatalf("Failed to read synonyms, %v", err)
+		}
+
+		opts.Synonyms = synonyms
+	}
+
+	if no_ignore_files {
+		opts.IgnoreFiles = []string{}
+	} else if len(ignore_files) > 0 {
+		opts.IgnoreFiles = ignore_files
+	}
+
+	idx := indexer.NewIndexWithOptions(opts)
 	defer idx.Close()
 
 	if index_uri != "" {
@@ -44,41 +122,107 @@ func main() {
 		}
 	}
 
-	var searchTerm string
+	query_opts := indexer.DefaultQueryOptions()
+	query_opts.MaxResults = max_results
+	query_opts.MaxMatches = max_matches
+	query_opts.CaseSensitive = case_sensitive
+	query_opts.Sort = sort_by
+
+	scanner := bufio.NewScanner(os.Stdin)
+
 	for {
 		fmt.Println("enter search term: ")
-		_, _ = fmt.Scanln(&searchTerm)
 
-		res := idx.Search(idx.Queryise(searchTerm))
+		if !scanner.Scan() {
+			break
+		}
+
+		searchTerm := scanner.Text()
+
+		count := 0
+
+		print_result := func(ctx context.Context, r *indexer.Result) error {
+
+			fmt.Println(r.File)
+			fmt.Printf("score: %.4f\n", r.Score)
+
+			for i, m := range r.Matches {
+
+				if max_matches > 0 && i >= max_matches {
+					break
+				}
+
+				fmt.Println(m)
+			}
+
+			fmt.Println("")
+
+			count += 1
+
+			if max_results > 0 && count >= max_results {
+				return indexer.StopSearch
+			}
+
+			return nil
+		}
+
 		fmt.Println("--------------")
-		fmt.Println(len(res), "index result(s)")
-		fmt.Println("")
 
-		for _, id := range res {
+		var err error
+
+		if use_regexp {
+
+			pattern := searchTerm
+
+			if !case_sensitive {
+				pattern = "(?i)" + pattern
+			}
 
-			r, err := idx.OpenFile(ctx, id)
+			re, re_err := regexp.Compile(pattern)
 
-			if err != nil {
-				slog.Error("Failed to open file for reading", "id", id, "error", err)
+			if re_err != nil {
+				fmt.Printf("Invalid regular expression, %v\n\n", re_err)
 				continue
 			}
 
-			defer r.Close()
+			var results []*indexer.Result
+			results, err = idx.SearchRegexp(ctx, re)
 
-			matching := indexer.FindMatchingLines(r, searchTerm, 5)
+			if err == nil {
 
-			if len(matching) == 0 {
-				continue
+				indexer.SortResults(results, sort_by)
+
+				for _, r := range results {
+
+					if print_result(ctx, r) != nil {
+						break
+					}
+				}
 			}
 
-			fmt.Println(idx.IdToFile(id))
-			
-			for _, l := range matching {
-				fmt.Println(l)
+		} else if sort_by == indexer.SortByScore {
+
+			var results []*indexer.Result
+			results, err = idx.Query(ctx, searchTerm, query_opts)
+
+			if err == nil {
+
+				for _, r := range results {
+					print_result(ctx, r)
+				}
 			}
-			
-			fmt.Println("")
+
+		} else {
+			err = idx.SearchFunc(ctx, searchTerm, query_opts, print_result)
+		}
+
+		if err != nil {
+			fmt.Printf("Failed to search index, %v\n\n", err)
+			continue
 		}
+
+		fmt.Println(count, "result(s)")
+		fmt.Println("")
 	}
 
 }
@@ -0,0 +1,135 @@
+package indexer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// CompressionNone signals that archives should not be compressed.
+	CompressionNone = "none"
+	// CompressionGzip signals that archives should be compressed using gzip.
+	CompressionGzip = "gzip"
+	// CompressionZstd signals that archives should be compressed using zstd.
+	CompressionZstd = "zstd"
+)
+
+// compressionQueryParameter is the name of the (optional) query parameter in an archive URI used to specify how
+// an archive should be compressed. It takes precedence over the archive URI's file extension.
+const compressionQueryParameter = "compression"
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// deriveArchiveCompression returns the archive URI, with any "compression" query parameter removed, and the compression
+// scheme for 'archive_uri' as determined by that query parameter or the archive's file extension (".gz" or ".zst").
+func deriveArchiveCompression(archive_uri string) (string, string, error) {
+
+	u, err := url.Parse(archive_uri)
+
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to parse archive URI, %w", err)
+	}
+
+	q := u.Query()
+
+	if q.Has(compressionQueryParameter) {
+
+		compression := q.Get(compressionQueryParameter)
+
+		switch compression {
+		case CompressionNone, CompressionGzip, CompressionZstd:
+			// pass
+		default:
+			return "", "", fmt.Errorf("Unsupported compression scheme '%s'", compression)
+		}
+
+		q.Del(compressionQueryParameter)
+		u.RawQuery = q.Encode()
+
+		return u.String(), compression, nil
+	}
+
+	return archive_uri, compressionForKey(u.Path), nil
+}
+
+// compressionForKey returns the compression scheme implied by the file extension of 'key'.
+func compressionForKey(key string) string {
+
+	switch strings.ToLower(filepath.Ext(key)) {
+	case ".gz":
+		return CompressionGzip
+	case ".zst":
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+// trimCompressionExtension returns 'key' with any file extension implying a compression scheme removed.
+func trimCompressionExtension(key string) string {
+
+	if compressionForKey(key) == CompressionNone {
+		return key
+	}
+
+	return strings.TrimSuffix(key, filepath.Ext(key))
+}
+
+// newCompressionWriter returns an `io.WriteCloser` which compresses data written to 'wr' using 'compression'.
+// Closing the returned writer does not close 'wr'.
+func newCompressionWriter(wr io.Writer, compression string) (io.WriteCloser, error) {
+
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewWriter(wr), nil
+	case CompressionZstd:
+		return zstd.NewWriter(wr)
+	case CompressionNone, "":
+		return nopWriteCloser{wr}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported compression scheme '%s'", compression)
+	}
+}
+
+// newDecompressionReader returns an `io.ReadCloser` which decompresses 'r' if it is gzip or zstd compressed, as
+// determined by its leading magic bytes, or which reads 'r' as-is.
+func newDecompressionReader(r io.Reader) (io.ReadCloser, error) {
+
+	br := bufio.NewReader(r)
+
+	magic, _ := br.Peek(len(zstdMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+
+		dec, err := zstd.NewReader(br)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return dec.IOReadCloser(), nil
+	default:
+		return io.NopCloser(br), nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,177 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDeriveArchiveCompression(t *testing.T) {
+
+	tests := []struct {
+		uri         string
+		expected    string
+		compression string
+	}{
+		{"file:///tmp/index.idx", "file:///tmp/index.idx", CompressionNone},
+		{"file:///tmp/index.idx.gz", "file:///tmp/index.idx.gz", CompressionGzip},
+		{"file:///tmp/index.idx.GZ", "file:///tmp/index.idx.GZ", CompressionGzip},
+		{"file:///tmp/index.bin.zst", "file:///tmp/index.bin.zst", CompressionZstd},
+		{"file:///tmp/index.idx?compression=gzip", "file:///tmp/index.idx", CompressionGzip},
+		{"file:///tmp/index.idx?compression=zstd&x=1", "file:///tmp/index.idx?x=1", CompressionZstd},
+		// the query parameter takes precedence over the file extension
+		{"file:///tmp/index.idx.gz?compression=none", "file:///tmp/index.idx.gz", CompressionNone},
+		{"file:///tmp/index.idx.zst?compression=gzip", "file:///tmp/index.idx.zst", CompressionGzip},
+	}
+
+	for _, test := range tests {
+
+		uri, compression, err := deriveArchiveCompression(test.uri)
+
+		if err != nil {
+			t.Fatalf("Failed to derive compression for %s, %v", test.uri, err)
+		}
+
+		if uri != test.expected || compression != test.compression {
+			t.Fatalf("Unexpected compression for %s: %s, %s (expected %s, %s)", test.uri, uri, compression, test.expected, test.compression)
+		}
+	}
+
+	_, _, err := deriveArchiveCompression("file:///tmp/index.idx?compression=bzip2")
+
+	if err == nil {
+		t.Fatalf("Expected error deriving unsupported compression")
+	}
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+
+	body := []byte(strings.Repeat("hello world\n", 1000))
+
+	tests := map[string][]byte{
+		CompressionGzip: gzipMagic,
+		CompressionZstd: zstdMagic,
+		CompressionNone: body[:4],
+	}
+
+	for compression, magic := range tests {
+
+		var buf bytes.Buffer
+
+		wr, err := newCompressionWriter(&buf, compression)
+
+		if err != nil {
+			t.Fatalf("Failed to create %s writer, %v", compression, err)
+		}
+
+		_, err = wr.Write(body)
+
+		if err != nil {
+			t.Fatalf("Failed to write %s data, %v", compression, err)
+		}
+
+		err = wr.Close()
+
+		if err != nil {
+			t.Fatalf("Failed to close %s writer, %v", compression, err)
+		}
+
+		if !bytes.HasPrefix(buf.Bytes(), magic) {
+			t.Fatalf("Unexpected leading bytes for %s data: %x", compression, buf.Bytes()[:4])
+		}
+
+		if compression != CompressionNone && buf.Len() >= len(body) {
+			t.Fatalf("Expected %s data to be compressed, %d bytes", compression, buf.Len())
+		}
+
+		r, err := newDecompressionReader(&buf)
+
+		if err != nil {
+			t.Fatalf("Failed to create reader for %s data, %v", compression, err)
+		}
+
+		decompressed, err := io.ReadAll(r)
+
+		if err != nil {
+			t.Fatalf("Failed to read %s data, %v", compression, err)
+		}
+
+		r.Close()
+
+		if !bytes.Equal(decompressed, body) {
+			t.Fatalf("Unexpected data after %s round trip", compression)
+		}
+	}
+
+	_, err := newCompressionWriter(io.Discard, "bzip2")
+
+	if err == nil {
+		t.Fatalf("Expected error creating writer for unsupported compression")
+	}
+}
+
+func TestArchiveWithURICompression(t *testing.T) {
+
+	ctx := context.Background()
+
+	idx, _ := newTestIndex(t, DefaultIndexOptions(), map[string]string{
+		"a.txt": "hello world",
+		"b.txt": "goodbye world",
+	})
+
+	root := t.TempDir()
+
+	tests := []struct {
+		name  string
+		query string
+		path  string
+		magic []byte
+	}{
+		{"index.idx.gz", "", "index.idx.gz", gzipMagic},
+		{"index.idx.zst", "", "index.idx.zst", zstdMagic},
+		{"index.bin.zst", "", "index.bin.zst", zstdMagic},
+		{"gzip.idx", "?compression=gzip", "gzip.idx", gzipMagic},
+		{"zstd.idx", "?compression=zstd", "zstd.idx", zstdMagic},
+		{"none.idx.gz", "?compression=none", "none.idx.gz", []byte("{")},
+	}
+
+	for _, test := range tests {
+
+		uri := "file://" + filepath.ToSlash(root) + "/" + test.name + test.query
+
+		err := idx.ExportArchiveWithURI(ctx, uri)
+
+		if err != nil {
+			t.Fatalf("Failed to export archive to %s, %v", uri, err)
+		}
+
+		enc, err := os.ReadFile(filepath.Join(root, test.path))
+
+		if err != nil {
+			t.Fatalf("Failed to read archive exported to %s, %v", uri, err)
+		}
+
+		if !bytes.HasPrefix(enc, test.magic) {
+			t.Fatalf("Unexpected leading bytes for archive exported to %s: %x", uri, enc[:4])
+		}
+
+		imported := NewIndex()
+
+		err = imported.ImportArchiveWithURI(ctx, uri)
+
+		if err != nil {
+			t.Fatalf("Failed to import archive from %s, %v", uri, err)
+		}
+
+		paths := queryPaths(t, imported, "goodbye")
+
+		if !slices.Equal(paths, []string{"b.txt"}) {
+			t.Fatalf("Unexpected results for archive imported from %s: %v", uri, paths)
+		}
+	}
+}
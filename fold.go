@@ -0,0 +1,126 @@
+package indexer
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// NormalizationNFC signals that text should be normalized using Unicode Normalization Form C (canonical composition).
+	NormalizationNFC = "nfc"
+	// NormalizationNFKC signals that text should be normalized using Unicode Normalization Form KC (compatibility composition).
+	NormalizationNFKC = "nfkc"
+)
+
+const (
+	// FoldCase signals that text should be case folded rather than simply lower-cased.
+	FoldCase = "case"
+	// FoldAccents signals that diacritical marks should be removed from text.
+	FoldAccents = "accents"
+)
+
+// textFolder normalizes text before it is split in to words.
+type textFolder struct {
+	// form is the (optional) Unicode normalization form, one of `NormalizationNFC` or `NormalizationNFKC`.
+	form string
+	// caseFold signals that text should be case folded rather than lower-cased.
+	caseFold bool
+	// accentFold signals that diacritical marks should be removed.
+	accentFold bool
+}
+
+// newTextFolder returns a new `textFolder` instance for the normalization form 'form' and the comma-separated list of
+// foldings 'fold'.
+func newTextFolder(form string, fold string) (*textFolder, error) {
+
+	f := &textFolder{}
+
+	switch form {
+	case NormalizationNFC, NormalizationNFKC, "":
+		f.form = form
+	default:
+		return nil, fmt.Errorf("Unsupported normalization form '%s'", form)
+	}
+
+	for _, v := range strings.Split(fold, ",") {
+
+		switch strings.TrimSpace(v) {
+		case FoldCase:
+			f.caseFold = true
+		case FoldAccents:
+			f.accentFold = true
+		case "":
+			// pass
+		default:
+			return nil, fmt.Errorf("Unsupported folding '%s'", v)
+		}
+	}
+
+	return f, nil
+}
+
+// folds returns the comma-separated list of foldings applied by 'f'.
+func (f *textFolder) folds() string {
+
+	folds := make([]string, 0)
+
+	if f.caseFold {
+		folds = append(folds, FoldCase)
+	}
+
+	if f.accentFold {
+		folds = append(folds, FoldAccents)
+	}
+
+	return strings.Join(folds, ",")
+}
+
+// fold returns 'text' normalized, lower-cased (or case folded) and with diacritical marks removed according to 'f'.
+func (f *textFolder) fold(text string) string {
+
+	switch f.form {
+	case NormalizationNFC:
+		text = norm.NFC.String(text)
+	case NormalizationNFKC:
+		text = norm.NFKC.String(text)
+	}
+
+	if f.caseFold {
+		text = strings.Map(foldRune, text)
+	} else {
+		text = strings.ToLower(text)
+	}
+
+	if f.accentFold {
+		text = removeAccents(text)
+	}
+
+	return text
+}
+
+// foldRune returns the simple case folding of 'r'. Characters with more than one lower case form, for example "ſ" and "s"
+// or "ς" and "σ", are folded to the same character.
+func foldRune(r rune) rune {
+	return unicode.ToLower(unicode.ToUpper(r))
+}
+
+// removeAccents returns 'text' with all the nonspacing marks (for example the acute accent in "é") removed from its canonical
+// decomposition and then recomposed.
+func removeAccents(text string) string {
+
+	decomposed := norm.NFD.String(text)
+
+	stripped := strings.Map(func(r rune) rune {
+
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+
+		return r
+	}, decomposed)
+
+	return norm.NFC.String(stripped)
+}
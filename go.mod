@@ -6,8 +6,10 @@ toolchain go1.22.3
 
 require (
 	github.com/aaronland/gocloud-blob v0.0.17
+	github.com/klauspost/compress v1.18.0
 	github.com/sfomuseum/go-flags v0.10.0
 	gocloud.dev v0.37.0
+	golang.org/x/text v0.14.0
 )
 
 require (
@@ -18,7 +20,6 @@ require (
 	go.opencensus.io v0.24.0 // indirect
 	golang.org/x/net v0.22.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
 	golang.org/x/xerrors v0.0.0-20231012003039-104605ab7028 // indirect
 	google.golang.org/api v0.169.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240311173647-c811ad7063a7 // indirect
@@ -0,0 +1,194 @@
+package indexer
+
+import (
+	"bufio"
+	"io"
+	"path"
+	"strings"
+)
+
+// ignorePattern implements a single (.gitignore style) glob pattern used to include or exclude
+// paths when walking a bucket.
+type ignorePattern struct {
+	// The glob pattern, relative to `base`
+	pattern string
+	// The directory (relative to the root of the bucket, with a trailing slash) the pattern is scoped to
+	base string
+	// Whether a match should be interpreted as "not ignored"
+	negate bool
+	// Whether the pattern only matches directories
+	dirOnly bool
+	// Whether the pattern is anchored to `base` (it contains a slash) or matches a path's base name at any depth
+	anchored bool
+}
+
+// newIgnorePattern returns a new `ignorePattern` instance for 'line' scoped to the directory 'base'. If 'line'
+// is empty or a comment then the boolean value will be false.
+func newIgnorePattern(line string, base string) (*ignorePattern, bool) {
+
+	line = strings.TrimRight(line, "\r")
+
+	// trailing spaces are ignored unless they are escaped, which we don't bother with
+	line = strings.TrimRight(line, " ")
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, false
+	}
+
+	p := &ignorePattern{
+		base: base,
+	}
+
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+
+	line = strings.TrimPrefix(line, `\`)
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimLeft(line, "/")
+	}
+
+	if line == "" {
+		return nil, false
+	}
+
+	p.pattern = line
+	return p, true
+}
+
+// Match reports whether 'rel_path' (relative to the root of the bucket, without a trailing slash) matches the pattern.
+func (p *ignorePattern) Match(rel_path string, is_dir bool) bool {
+
+	if p.dirOnly && !is_dir {
+		return false
+	}
+
+	if !strings.HasPrefix(rel_path, p.base) {
+		return false
+	}
+
+	rel_path = strings.TrimPrefix(rel_path, p.base)
+
+	if !p.anchored {
+		return matchGlob(p.pattern, path.Base(rel_path))
+	}
+
+	return matchGlob(p.pattern, rel_path)
+}
+
+// ignoreRules implements an ordered list of `ignorePattern` instances where the last matching pattern wins.
+type ignoreRules []*ignorePattern
+
+// Match reports whether 'rel_path' matches any of the rules, accounting for negated patterns.
+func (rules ignoreRules) Match(rel_path string, is_dir bool) bool {
+
+	matched := false
+
+	for _, p := range rules {
+
+		if p.Match(rel_path, is_dir) {
+			matched = !p.negate
+		}
+	}
+
+	return matched
+}
+
+// parseIgnoreRules reads .gitignore style patterns from 'r' scoped to the directory 'base'.
+func parseIgnoreRules(r io.Reader, base string) (ignoreRules, error) {
+
+	rules := make(ignoreRules, 0)
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+
+		p, ok := newIgnorePattern(scanner.Text(), base)
+
+		if ok {
+			rules = append(rules, p)
+		}
+	}
+
+	err := scanner.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// compileGlobs returns `ignoreRules` for a list of (include or exclude) glob patterns relative to the root of a bucket.
+func compileGlobs(globs []string) ignoreRules {
+
+	rules := make(ignoreRules, 0)
+
+	for _, g := range globs {
+
+		p, ok := newIgnorePattern(g, "")
+
+		if ok {
+			rules = append(rules, p)
+		}
+	}
+
+	return rules
+}
+
+// matchGlob reports whether 'name' matches 'pattern' where both are slash-separated paths and the
+// path segment "**" in 'pattern' matches zero or more path segments in 'name'. Malformed patterns
+// never match.
+func matchGlob(pattern string, name string) bool {
+	return matchGlobSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobSegments(pattern []string, name []string) bool {
+
+	for len(pattern) > 0 {
+
+		if pattern[0] == "**" {
+
+			// collapse consecutive "**" segments
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+
+			if len(pattern) == 0 {
+				return true
+			}
+
+			for i := 0; i <= len(name); i++ {
+
+				if matchGlobSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		ok, err := path.Match(pattern[0], name[0])
+
+		if err != nil || !ok {
+			return false
+		}
+
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+
+	return len(name) == 0
+}
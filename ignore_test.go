@@ -0,0 +1,118 @@
+package indexer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{`*.go`, `index.go`, true},
+		{`*.go`, `index.go.bak`, false},
+		{`*.go`, `cmd/index.go`, false},
+		{`index.?o`, `index.go`, true},
+		{`[a-c]*.txt`, `b.txt`, true},
+		{`[a-c]*.txt`, `d.txt`, false},
+		{`cmd/*/main.go`, `cmd/index/main.go`, true},
+		{`cmd/*/main.go`, `cmd/index/sub/main.go`, false},
+		// "**" matches zero or more path segments
+		{`**/main.go`, `main.go`, true},
+		{`**/main.go`, `cmd/index/main.go`, true},
+		{`cmd/**`, `cmd/index/main.go`, true},
+		{`cmd/**/main.go`, `cmd/main.go`, true},
+		{`cmd/**/main.go`, `cmd/a/b/main.go`, true},
+		{`cmd/**/main.go`, `vendor/cmd/main.go`, false},
+		{`a/**/**/b`, `a/x/b`, true},
+		// "**" is only special as a whole path segment
+		{`**.go`, `cmd/main.go`, false},
+		// malformed patterns never match
+		{`[`, `[`, false},
+	}
+
+	for _, test := range tests {
+
+		actual := matchGlob(test.pattern, test.name)
+
+		if actual != test.expected {
+			t.Fatalf("Unexpected result matching '%s' against '%s': %t (expected %t)", test.name, test.pattern, actual, test.expected)
+		}
+	}
+}
+
+func TestIgnoreRules(t *testing.T) {
+
+	// the contents of an ignore file in the directory "src/"
+	ignore_file := `
+# comments and empty lines are ignored
+*.log
+!important.log
+build/
+/tmp
+docs/*.md
+\#hash
+`
+
+	rules, err := parseIgnoreRules(strings.NewReader(ignore_file), "src/")
+
+	if err != nil {
+		t.Fatalf("Failed to parse ignore rules, %v", err)
+	}
+
+	if len(rules) != 6 {
+		t.Fatalf("Unexpected number of rules: %d", len(rules))
+	}
+
+	tests := []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		// unanchored patterns match a base name at any depth below the ignore file
+		{`src/debug.log`, false, true},
+		{`src/a/b/debug.log`, false, true},
+		{`debug.log`, false, false},
+		// negated patterns re-include paths matched by an earlier pattern
+		{`src/important.log`, false, false},
+		{`src/a/important.log`, false, false},
+		// directory-only patterns don't match files
+		{`src/build`, true, true},
+		{`src/a/build`, true, true},
+		{`src/build`, false, false},
+		// patterns containing a slash are anchored to the directory of the ignore file
+		{`src/tmp`, true, true},
+		{`src/tmp`, false, true},
+		{`src/a/tmp`, true, false},
+		{`src/docs/README.md`, false, true},
+		{`src/a/docs/README.md`, false, false},
+		{`src/docs/a/README.md`, false, false},
+		// a leading backslash escapes a "#"
+		{`src/#hash`, false, true},
+		{`src/main.go`, false, false},
+	}
+
+	for _, test := range tests {
+
+		actual := rules.Match(test.path, test.isDir)
+
+		if actual != test.expected {
+			t.Fatalf("Unexpected result matching '%s' (directory %t): %t (expected %t)", test.path, test.isDir, actual, test.expected)
+		}
+	}
+
+	// the last matching pattern wins so a negation followed by a broader pattern is overridden
+
+	globs := compileGlobs([]string{"!keep.txt", "*.txt", "", "#comment"})
+
+	if len(globs) != 2 {
+		t.Fatalf("Unexpected number of globs: %d", len(globs))
+	}
+
+	if !globs.Match("keep.txt", false) {
+		t.Fatalf("Expected 'keep.txt' to match the last pattern")
+	}
+}
@@ -1,59 +1,197 @@
 package indexer
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"math"
+	"runtime"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/aaronland/gocloud-blob/bucket"
-	"github.com/aaronland/gocloud-blob/walk"
 	"gocloud.dev/blob"
 )
 
-// Index implements a bloom filter based search index
+// Index implements a bloom filter based search index. It is safe to use an `Index` from multiple goroutines:
+// any number of callers may search the index (using `Search`, `OpenFile`, `IdToFile`, `Archive`, etc.) while
+// documents are being added to it. Methods which modify the index (`IndexBuckets`, `Add`, `Update`, `Remove`,
+// `Compact`, `ImportArchive`, etc.) are serialized so there is only ever one writer at a time. A document becomes
+// visible to searches only once both its bloom filter bits and its file record have been added. Each call to `Search`
+// or `SearchQuery` sees a consistent snapshot of the documents which had been added when it started. Searches which
+// verify documents as they go (`SearchFunc`, `Query`, etc.) may also include documents added while they are running,
+// and fail with `ErrIndexChanged` if the index is renumbered or replaced while they are running.
 type Index struct {
+	// mu guards the documents and configuration of the index
+	mu sync.RWMutex
+	// writerMu ensures there is only one writer at a time
+	writerMu sync.Mutex
+	// bucketsMu guards the buckets map
+	bucketsMu                      sync.Mutex
 	currentBlockDocumentCount      int
 	bloomFilter                    []uint64
 	currentDocumentCount           int
 	currentBlockStartDocumentCount int
-	trigramMethod                  string
+	tokenizer                      Tokenizer
+	synonyms                       *Synonyms
+	bloomSize                      int
+	bloomHashes                    int
+	termTable                      *TermTable
+	adaptiveHashes                 bool
 	idToFile                       []*File
 	buckets                        map[string]*blob.Bucket
 	bucketURIs                     map[string]uint32
 	maxBucketId                    uint32
 	maxBytes                       int64
+	include                        ignoreRules
+	exclude                        ignoreRules
+	ignoreFiles                    []string
+	includeHidden                  bool
+	tombstones                     map[uint32]bool
+	archiveFormat                  string
+	workers                        int
+	// generation is incremented whenever the index is replaced (by `ImportArchive`), its documents are renumbered (by
+	// `Update` or `Compact`) or its term table is derived, which invalidates any queries compiled, and document ids found,
+	// for the previous generation (see `compileQuery`)
+	generation uint64
 }
 
 type IndexOptions struct {
+	// Method is the name of the trigram method used to tokenize documents if Tokenizer is nil.
 	Method string
+	// Tokenizer is the (optional) `Tokenizer` used to tokenize documents and queries. If nil a trigram tokenizer for Method is used.
+	Tokenizer Tokenizer
+	// Synonyms is an (optional) dictionary of equivalent terms and phrases which are expanded when queries are searched.
+	Synonyms *Synonyms
 	MaxBytes int64
+	// BloomSize is the number of bits in the bloom filter for each document. Smaller values use less memory but yield more
+	// false positives. If 0 the default `BloomSize` is used.
+	BloomSize int
+	// BloomHashes is the number of hash functions used to derive the bloom filter positions for each token. If 0 the
+	// default `BloomHashes` is used.
+	BloomHashes int
+	// TermTable is an (optional) `TermTable` assigning the number of hash functions used for each token. If nil every token
+	// is hashed using BloomHashes hash functions.
+	TermTable *TermTable
+	// AdaptiveHashes signals that, if the index has no TermTable, one should be derived from the frequency of each token
+	// the first time buckets are indexed. This requires every document to be read twice.
+	AdaptiveHashes bool
+	// Include is an optional list of (.gitignore style) glob patterns. If present only files matching at least one pattern will be indexed.
+	Include []string
+	// Exclude is an optional list of (.gitignore style) glob patterns. Files and directories matching any pattern will not be indexed.
+	Exclude []string
+	// IgnoreFiles is the list of file names (for example ".gitignore") whose rules will be honoured when they are encountered while walking a bucket.
+	IgnoreFiles []string
+	// IncludeHidden signals that directories whose names start with "." should be indexed.
+	IncludeHidden bool
+	// ArchiveFormat is the encoding (ArchiveFormatJSON or ArchiveFormatBinary) used to export archives. When exporting
+	// an archive with a URI whose file extension is ".json" or ".bin" the extension takes precedence.
+	ArchiveFormat string
+	// Workers is the number of documents to read and tokenize concurrently when indexing a bucket. Documents are
+	// always added to the index in the order they are encountered so document ids do not depend on this value.
+	Workers int
 }
 
 type File struct {
 	Path     string `json:"path"`
-	BucketId uint32 `json:"bucket_id`
+	BucketId uint32 `json:"bucket_id"`
+	// The size of the file, in bytes, when it was indexed
+	Size int64 `json:"size,omitempty"`
+	// The last modification time of the file when it was indexed
+	ModTime time.Time `json:"mod_time"`
+	// The hex-encoded MD5 hash of the file's contents, if reported by the bucket, when it was indexed
+	MD5 string `json:"md5,omitempty"`
+}
+
+// UnmarshalJSON decodes a JSON-encoded `File` record. Archives created before the "bucket_id" key was introduced
+// store the bucket id using the "BucketId" key so that key is also accepted.
+func (f *File) UnmarshalJSON(data []byte) error {
+
+	// file has the same fields as File but not its methods so decoding it won't recurse
+	type file File
+
+	var aux struct {
+		file
+		LegacyBucketId *uint32 `json:"BucketId"`
+	}
+
+	err := json.Unmarshal(data, &aux)
+
+	if err != nil {
+		return err
+	}
+
+	*f = File(aux.file)
+
+	if aux.LegacyBucketId != nil {
+		f.BucketId = *aux.LegacyBucketId
+	}
+
+	return nil
+}
+
+// newFile returns a new `File` instance for 'obj' contained by the bucket identified by 'bucket_id'.
+func newFile(bucket_id uint32, obj *blob.ListObject) *File {
+
+	f := &File{
+		Path:     obj.Key,
+		BucketId: bucket_id,
+		Size:     obj.Size,
+		ModTime:  obj.ModTime,
+	}
+
+	if len(obj.MD5) > 0 {
+		f.MD5 = hex.EncodeToString(obj.MD5)
+	}
+
+	return f
+}
+
+// Unchanged reports whether 'obj' appears to be the same (unmodified) object that 'f' was derived from.
+func (f *File) Unchanged(obj *blob.ListObject) bool {
+
+	if f.Path != obj.Key || f.Size != obj.Size {
+		return false
+	}
+
+	if f.MD5 != "" && len(obj.MD5) > 0 {
+		return f.MD5 == hex.EncodeToString(obj.MD5)
+	}
+
+	return f.ModTime.Equal(obj.ModTime)
 }
 
 // Archive implements a struct containing data for serializing and deserializing `Index` instances
 type Archive struct {
+	// Header records the parameters used to create the index. It will be nil for archives created before
+	// headers were introduced in which case the importing index's own configuration is assumed.
+	Header      *ArchiveHeader    `json:"header,omitempty"`
 	BloomFilter []uint64          `json:"bloom_filter"`
 	IdToFile    []*File           `json:"id_to_file"`
 	BucketURIs  map[string]uint32 `json:"bucket_uris"`
+	Tombstones  []uint32          `json:"tombstones,omitempty"`
 }
 
 func DefaultIndexOptions() *IndexOptions {
-	
+
 	opts := &IndexOptions{
-		Method: "default",
-		MaxBytes: int64(5000),
+		Method:        "default",
+		MaxBytes:      int64(5000),
+		Include:       make([]string, 0),
+		Exclude:       make([]string, 0),
+		IgnoreFiles:   DefaultIgnoreFiles(),
+		ArchiveFormat: ArchiveFormatJSON,
+		Workers:       runtime.NumCPU(),
 	}
 
 	return opts
@@ -65,38 +203,88 @@ func NewIndex() *Index {
 	return NewIndexWithOptions(opts)
 }
 
-func NewIndexWithOptions(opts *IndexOptions) *Index {	
+// DefaultIgnoreFiles returns the list of ignore file names honoured by default when walking a bucket.
+func DefaultIgnoreFiles() []string {
+	return []string{".gitignore", ".ignore"}
+}
+
+func NewIndexWithOptions(opts *IndexOptions) *Index {
+
+	var tokenizer Tokenizer = opts.Tokenizer
+
+	if tokenizer == nil {
+		tokenizer = newTrigramTokenizer(opts.Method, true)
+	}
+
+	bloom_size := opts.BloomSize
+
+	if bloom_size <= 0 {
+		bloom_size = BloomSize
+	}
+
+	bloom_hashes := opts.BloomHashes
+
+	if bloom_hashes <= 0 {
+		bloom_hashes = BloomHashes
+	}
+
+	if bloom_hashes > maxBloomHashes {
+		bloom_hashes = maxBloomHashes
+	}
 
 	i := &Index{
 		currentBlockDocumentCount:      0,
 		bloomFilter:                    make([]uint64, 0),
 		currentDocumentCount:           0,
 		currentBlockStartDocumentCount: 0,
-		trigramMethod:                  opts.Method,
+		tokenizer:                      tokenizer,
+		synonyms:                       opts.Synonyms,
+		bloomSize:                      bloom_size,
+		bloomHashes:                    bloom_hashes,
+		termTable:                      opts.TermTable,
+		adaptiveHashes:                 opts.AdaptiveHashes,
 		idToFile:                       make([]*File, 0),
 		buckets:                        make(map[string]*blob.Bucket),
 		bucketURIs:                     make(map[string]uint32),
 		maxBucketId:                    uint32(0),
 		maxBytes:                       opts.MaxBytes,
+		include:                        compileGlobs(opts.Include),
+		exclude:                        compileGlobs(opts.Exclude),
+		ignoreFiles:                    opts.IgnoreFiles,
+		includeHidden:                  opts.IncludeHidden,
+		tombstones:                     make(map[uint32]bool),
+		archiveFormat:                  opts.ArchiveFormat,
+		workers:                        opts.Workers,
 	}
 
 	return i
 }
 
+// IndexBuckets walks and indexes each bucket in 'bucket_uris' appending the documents it finds to the index. Buckets
+// which have already been indexed should be refreshed using the `Update` method rather than indexed again.
 func (idx *Index) IndexBuckets(ctx context.Context, bucket_uris ...string) error {
 
+	idx.writerMu.Lock()
+	defer idx.writerMu.Unlock()
+
+	if idx.needsTermTable() {
+
+		err := idx.buildTermTable(ctx, bucket_uris...)
+
+		if err != nil {
+			return fmt.Errorf("Failed to build term table, %w", err)
+		}
+	}
+
 	for i, uri := range bucket_uris {
 
-		b, err := bucket.OpenBucket(ctx, uri)
+		b, err := idx.openBucket(ctx, uri)
 
 		if err != nil {
 			return fmt.Errorf("Failed to open bucket for '%s', %w", uri, err)
 		}
 
-		bucket_id := atomic.AddUint32(&idx.maxBucketId, uint32(i))
-
-		idx.buckets[uri] = b
-		idx.bucketURIs[uri] = bucket_id
+		bucket_id := idx.bucketId(uri)
 
 		err = idx.indexBucket(ctx, b, bucket_id)
 
@@ -108,33 +296,106 @@ func (idx *Index) IndexBuckets(ctx context.Context, bucket_uris ...string) error
 	return nil
 }
 
+// bucketId returns the id associated with 'uri' assigning a new id if necessary.
+func (idx *Index) bucketId(uri string) uint32 {
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	bucket_id, exists := idx.bucketURIs[uri]
+
+	if exists {
+		return bucket_id
+	}
+
+	if len(idx.bucketURIs) > 0 {
+		bucket_id = atomic.AddUint32(&idx.maxBucketId, 1)
+	}
+
+	idx.bucketURIs[uri] = bucket_id
+	return bucket_id
+}
+
 func (idx *Index) indexBucket(ctx context.Context, b *blob.Bucket, bucket_id uint32) error {
 
+	p := newIndexPipeline(ctx, idx, idx.workers)
+
 	walk_cb := func(ctx context.Context, obj *blob.ListObject) error {
 
 		if obj.IsDir {
 			return nil // we only care about files
 		}
 
-		err := idx.IndexObject(ctx, b, bucket_id, obj)
-
-		if err != nil {
-			return fmt.Errorf("Failed to index %s, %w", obj.Key, err)
+		job := func(ctx context.Context) (*indexedDocument, error) {
+			return idx.readDocument(ctx, b, bucket_id, obj)
 		}
 
-		return nil
+		return p.Submit(job)
 	}
 
-	return walk.WalkBucket(ctx, b, walk_cb)
+	err := idx.walkBucket(p.Context(), b, walk_cb)
+
+	// always wait for any pending documents to be added to the index, and report
+	// errors adding them in preference to (context) errors walking the bucket
+
+	wait_err := p.Wait()
+
+	if wait_err != nil {
+		return wait_err
+	}
+
+	return err
 }
 
+// IndexObject reads and tokenizes 'obj' and adds it to the index.
 func (idx *Index) IndexObject(ctx context.Context, b *blob.Bucket, bucket_id uint32, obj *blob.ListObject) error {
 
+	doc, err := idx.readDocument(ctx, b, bucket_id, obj)
+
+	if err != nil {
+		return err
+	}
+
+	if doc == nil {
+		return nil
+	}
+
+	return idx.addDocument(doc)
+}
+
+// indexedDocument is the bloom filter bits and file record for a document that has been tokenized but not yet added to an index.
+type indexedDocument struct {
+	item []bool
+	file *File
+}
+
+// readDocument reads and tokenizes 'obj' returning the data needed to add it to the index. If 'obj' can not be read
+// or appears to be a binary file a nil `indexedDocument` is returned. It is safe to call this method concurrently.
+func (idx *Index) readDocument(ctx context.Context, b *blob.Bucket, bucket_id uint32, obj *blob.ListObject) (*indexedDocument, error) {
+
+	text, ok := idx.readDocumentText(ctx, b, obj)
+
+	if !ok {
+		return nil, nil
+	}
+
+	doc := &indexedDocument{
+		item: idx.Itemise(idx.Tokenize(text)),
+		file: newFile(bucket_id, obj),
+	}
+
+	return doc, nil
+}
+
+// readDocumentText returns the (first maxBytes bytes of the) text of 'obj' and a boolean value indicating whether
+// it should be indexed. Errors reading 'obj' are logged and the document is skipped.
+func (idx *Index) readDocumentText(ctx context.Context, b *blob.Bucket, obj *blob.ListObject) (string, bool) {
+
 	r, err := b.NewRangeReader(ctx, obj.Key, 0, idx.maxBytes, nil)
 
 	if err != nil {
 		slog.Warn("Failed to open file for reading", "path", obj.Key, "error", err)
-		return nil // swallow error
+		return "", false // swallow error
 	}
 
 	defer r.Close()
@@ -143,35 +404,56 @@ func (idx *Index) IndexObject(ctx context.Context, b *blob.Bucket, bucket_id uin
 
 	if err != nil {
 		slog.Warn("Failed to read file", "path", obj.Key, "error", err)
-		return nil
+		return "", false
 	}
 
 	// don't index binary files by looking for nul byte, similar to how grep does it
 	if bytes.IndexByte(res, 0) != -1 {
-		return nil
+		return "", false
+	}
+
+	return string(res), true
+}
+
+// addDocument adds 'doc' to the index. The bloom filter bits and the file record are added atomically
+// with respect to searches. If 'doc' has no file record only its bloom filter bits are added, as they
+// are by `Add`.
+func (idx *Index) addDocument(doc *indexedDocument) error {
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	// file records are looked up by document id so they can't follow documents without one
+	if doc.file != nil && len(idx.idToFile) != idx.currentDocumentCount {
+		return fmt.Errorf("Files can not be indexed after documents without a file record have been added")
 	}
 
 	// add the document to the index
-	err = idx.Add(Itemise(idx.Tokenize(string(res))))
+	err := idx.add(doc.item)
 
 	if err != nil {
 		return err
 	}
 
-	// store the association from what's in the index to the filename, we know its 0 to whatever so this works
-
-	f := &File{
-		Path:     obj.Key,
-		BucketId: bucket_id,
+	if doc.file == nil {
+		return nil
 	}
 
-	idx.idToFile = append(idx.idToFile, f)
+	// store the association from what's in the index to the filename, we know its 0 to whatever so this works
+	idx.idToFile = append(idx.idToFile, doc.file)
 	return nil
 }
 
 // Search the results we need to look at very quickly using only bit operations
-// mostly limited by memory access
+// mostly limited by memory access. The query bits must be derived using the index
+// (see `Queryise`) since bits derived for a different bloom filter size (for example
+// using the package-level `HashBloom` function) won't match the same documents; if
+// any of them are outside the index's bloom filter no results are returned
 func (idx *Index) Search(queryBits []uint64) []uint32 {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
 	var results []uint32
 	var res uint64
 
@@ -179,8 +461,15 @@ func (idx *Index) Search(queryBits []uint64) []uint32 {
 		return results
 	}
 
+	for _, b := range queryBits {
+
+		if b >= uint64(idx.bloomSize) {
+			return results
+		}
+	}
+
 	// we want to go through the index, stepping though each "shard"
-	for i := 0; i < len(idx.bloomFilter); i += BloomSize {
+	for i := 0; i < len(idx.bloomFilter); i += idx.bloomSize {
 		// preload the res with the result of the first queryBit and if it's not 0 then we continue
 		// if it is 0 it means nothing can be a match so we don't need to do anything
 		res = idx.bloomFilter[queryBits[0]+uint64(i)]
@@ -204,7 +493,15 @@ func (idx *Index) Search(queryBits []uint64) []uint32 {
 				// determine which bits are still set indicating they have all the bits
 				// set for this query which means we have a potential match
 				if res&(1<<j) > 0 {
-					results = append(results, uint32(DocumentsPerBlock*(i/BloomSize)+j))
+
+					id := uint32(DocumentsPerBlock*(i/idx.bloomSize) + j)
+
+					// skip documents which have been removed
+					if idx.tombstones[id] {
+						continue
+					}
+
+					results = append(results, id)
 				}
 			}
 		}
@@ -214,42 +511,70 @@ func (idx *Index) Search(queryBits []uint64) []uint32 {
 	return results
 }
 
-// Tokenize returns a slice of tokens for the given text.
+// Tokenize returns a slice of tokens for the given text using the index's `Tokenizer`.
 func (idx *Index) Tokenize(text string) []string {
-	res := strings.Fields(strings.ToLower(text))
-	var cres []string
-	for _, v := range res {
-		if len(v) >= 3 {
-			cres = append(cres, v)
-		}
-	}
+	return idx.Tokenizer().Tokenize(text)
+}
 
-	// now we have clean tokens trigram them
-	var trigrams []string
-	for _, r := range cres {
-		switch idx.trigramMethod {
-		case "merovius":
-			trigrams = append(trigrams, TrigramsMerovius(r)...)
-		case "dancantos":
-			trigrams = append(trigrams, TrigramsDancantos(r)...)
-		case "ffmiruz":
-			trigrams = append(trigrams, TrigramsFfmiruz(r)...)
-		case "jamesrom":
-			for _, t := range TrigramsJamesrom(r) {
-				trigrams = append(trigrams, string(t.Bytes()))
-			}
-		default:
-			trigrams = append(trigrams, Trigrams(r)...)
-		}
+// Normalize returns 'text' in the normalized form used by the index's `Tokenizer`.
+func (idx *Index) Normalize(text string) string {
+	return idx.Tokenizer().Normalize(text)
+}
+
+// Tokenizer returns the `Tokenizer` used to tokenize documents and queries.
+func (idx *Index) Tokenizer() Tokenizer {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.tokenizer
+}
+
+// SetSynonyms sets the dictionary of equivalent terms and phrases which are expanded when queries are searched. If 's' is
+// nil synonyms are not expanded.
+func (idx *Index) SetSynonyms(s *Synonyms) {
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.synonyms = s
+}
+
+// ExpandSynonyms returns 'node' with each term or (case-insensitive) phrase which appears in the index's synonym dictionary
+// replaced by an `OrNode` matching any of its synonyms. If the index has no synonyms 'node' is returned as-is.
+func (idx *Index) ExpandSynonyms(node QueryNode) QueryNode {
 
+	idx.mu.RLock()
+	synonyms := idx.synonyms
+	tokenizer := idx.tokenizer
+	idx.mu.RUnlock()
+
+	return synonyms.expand(node, tokenizer.Normalize)
+}
+
+// SpanningTrigrams returns the trigrams which span the boundary between the adjacent words 'a' and 'b' when
+// they are joined by a single space. For example "new" and "york" yield "ew ", "w y" and " yo".
+func SpanningTrigrams(a string, b string) []string {
+
+	ra := []rune(a)
+	rb := []rune(b)
+
+	if len(ra) > 2 {
+		ra = ra[len(ra)-2:]
 	}
 
-	return trigrams
+	if len(rb) > 2 {
+		rb = rb[:2]
+	}
+
+	return Trigrams(string(ra) + " " + string(rb))
 }
 
 // Itemise given some content will turn it into tokens
 // and then use those to create the bit positions we need to
-// set for our bloomFilter filter index
+// set for our bloomFilter filter index. It uses the default
+// bloom filter size and hash functions, see the `Itemise`
+// method of `Index` for indices configured otherwise
 func Itemise(tokens []string) []bool {
 	docBool := make([]bool, BloomSize)
 
@@ -261,14 +586,52 @@ func Itemise(tokens []string) []bool {
 	return docBool
 }
 
+// Itemise is like the package-level `Itemise` function but uses
+// the index's bloom filter size and number of hash functions
+// (for each token, see `TermTable`)
+func (idx *Index) Itemise(tokens []string) []bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	docBool := make([]bool, idx.bloomSize)
+
+	for _, token := range tokens {
+		for _, i := range HashBloomWithSize([]byte(token), idx.bloomSize, idx.hashCount(token)) {
+			docBool[i] = true
+		}
+	}
+	return docBool
+}
+
 // Queryise given some content will turn it into tokens
 // and then hash them and store the resulting values into
 // a slice which we can use to query the bloom filter
 func (idx *Index) Queryise(query string) []uint64 {
+
+	// each word is tokenized on its own so that words in the query don't need to be adjacent in a document
+	var tokens []string
+	for _, w := range strings.Fields(query) {
+		tokens = append(tokens, idx.Tokenize(w)...)
+	}
+
+	return idx.hashTokens(tokens)
+}
+
+// QueryisePhrase is like Queryise but also includes the tokens spanning adjacent words
+// so the query bits will only match documents where the words occur in sequence. If the
+// index was created without spanning tokens it is the same as Queryise
+func (idx *Index) QueryisePhrase(phrase string) []uint64 {
+	return idx.hashTokens(idx.Tokenize(phrase))
+}
+
+// hashTokens returns the sorted and de-duplicated bloom filter positions for tokens
+func (idx *Index) hashTokens(tokens []string) []uint64 {
+	idx.mu.RLock()
 	var queryBits []uint64
-	for _, w := range idx.Tokenize(query) {
-		queryBits = append(queryBits, HashBloom([]byte(w))...)
+	for _, w := range tokens {
+		queryBits = append(queryBits, HashBloomWithSize([]byte(w), idx.bloomSize, idx.hashCount(w))...)
 	}
+	idx.mu.RUnlock()
 
 	// removing duplicates and sorting should in theory improve RAM access
 	// and hence performance
@@ -280,26 +643,51 @@ func (idx *Index) Queryise(query string) []uint64 {
 	return queryBits
 }
 
+// bloomParameters returns the number of bits in the bloom filter for each document and the number of hash functions
+// used to derive the bloom filter positions for each token.
+func (idx *Index) bloomParameters() (int, int) {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.bloomSize, idx.bloomHashes
+}
+
 // Add adds items into the internal bloomFilter used later for pre-screening documents
-// note that it fills the filter from right to left, which might not be what you expect
+// note that it fills the filter from right to left, which might not be what you expect.
+// Documents added this way don't have a file record so they are returned by `Search`
+// and `SearchQuery` but can't be verified by `Query`, they are dropped by `Update` and
+// files can no longer be indexed once one has been added
 func (idx *Index) Add(item []bool) error {
+
+	idx.writerMu.Lock()
+	defer idx.writerMu.Unlock()
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	return idx.add(item)
+}
+
+// add implements the `Add` method. It assumes the caller has acquired a write lock on the index.
+func (idx *Index) add(item []bool) error {
 	// bailout if we ever get something that will break the index
 	// because it does not match the size we expect
-	if len(item) != BloomSize {
-		return errors.New(fmt.Sprintf("expected to match size %d", BloomSize))
+	if len(item) != idx.bloomSize {
+		return errors.New(fmt.Sprintf("expected to match size %d", idx.bloomSize))
 	}
 
 	// we need to know if we need to add another batch to this index...
 	// which should only be called if we are building from the start
 	// or if we need to reset
 	if idx.currentBlockDocumentCount == 0 || idx.currentBlockDocumentCount == DocumentsPerBlock {
-		idx.bloomFilter = append(idx.bloomFilter, make([]uint64, BloomSize)...)
+		idx.bloomFilter = append(idx.bloomFilter, make([]uint64, idx.bloomSize)...)
 		idx.currentBlockDocumentCount = 0
 
 		// We don't want to do this for the first document, but everything after
 		// we want to know the offset, so in short trail by 1 BloomSize
 		if idx.currentDocumentCount != 0 {
-			idx.currentBlockStartDocumentCount += BloomSize
+			idx.currentBlockStartDocumentCount += idx.bloomSize
 		}
 	}
 
@@ -319,12 +707,60 @@ func (idx *Index) Add(item []bool) error {
 	return nil
 }
 
+// deriveCursors sets the document and block counters used by `Add` from the current bloom filter and the
+// number of documents, 'count', in it, for example after an index has been imported from an archive.
+func (idx *Index) deriveCursors(count int) error {
+
+	blocks := len(idx.bloomFilter) / idx.bloomSize
+
+	err := checkBloomFilterLength(len(idx.bloomFilter), count, idx.bloomSize)
+
+	if err != nil {
+		return err
+	}
+
+	idx.currentDocumentCount = count
+
+	if count == 0 {
+		idx.currentBlockDocumentCount = 0
+		idx.currentBlockStartDocumentCount = 0
+		return nil
+	}
+
+	idx.currentBlockStartDocumentCount = (blocks - 1) * idx.bloomSize
+	idx.currentBlockDocumentCount = count - ((blocks - 1) * DocumentsPerBlock)
+
+	return nil
+}
+
+// checkBloomFilterLength ensures that a bloom filter with 'length' words is the correct size for 'count' documents
+// when each block has 'size' words.
+func checkBloomFilterLength(length int, count int, size int) error {
+
+	if length%size != 0 {
+		return fmt.Errorf("Bloom filter length (%d) is not a multiple of %d", length, size)
+	}
+
+	blocks := length / size
+	expected := (count + DocumentsPerBlock - 1) / DocumentsPerBlock
+
+	if blocks != expected {
+		return fmt.Errorf("Bloom filter has %d blocks but %d documents require %d blocks", blocks, count, expected)
+	}
+
+	return nil
+}
+
 // PrintIndex prints out the index which can be useful from time
 // to time to ensure that bits are being set correctly.
 func (idx *Index) PrintIndex() {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
 	// display what the bloomFilter filter looks like broken into chunks
 	for j, i := range idx.bloomFilter {
-		if j%BloomSize == 0 {
+		if j%idx.bloomSize == 0 {
 			fmt.Println("")
 		}
 
@@ -334,63 +770,112 @@ func (idx *Index) PrintIndex() {
 
 func (idx *Index) OpenFile(ctx context.Context, id uint32) (io.ReadCloser, error) {
 
-	f := idx.idToFile[id]
+	f := idx.IdToFile(id)
 
 	if f == nil {
 		return nil, fmt.Errorf("Not found")
 	}
 
-	var bucket_uri string
-
-	for uri, idx := range idx.bucketURIs {
-
-		if idx == f.BucketId {
-			bucket_uri = uri
-			break
-		}
-	}
+	bucket_uri := idx.bucketURI(f.BucketId)
 
 	if bucket_uri == "" {
 		return nil, fmt.Errorf("Failed to derive bucket URI for file")
 	}
 
-	var b *blob.Bucket
-	open_b, exists := idx.buckets[bucket_uri]
+	b, err := idx.openBucket(ctx, bucket_uri)
 
-	if exists {
-		b = open_b
-	} else {
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open bucket, %w", err)
+	}
 
-		new_b, err := bucket.OpenBucket(ctx, bucket_uri)
+	return b.NewReader(ctx, f.Path, nil)
+}
 
-		if err != nil {
-			return nil, fmt.Errorf("Failed to open bucket, %w", err)
+// bucketURI returns the URI of the bucket associated with 'bucket_id' or an empty string if it is unknown.
+func (idx *Index) bucketURI(bucket_id uint32) string {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	for uri, id := range idx.bucketURIs {
+
+		if id == bucket_id {
+			return uri
 		}
+	}
 
-		b = new_b
-		idx.buckets[bucket_uri] = b
+	return ""
+}
+
+// openBucket returns the `blob.Bucket` instance for 'bucket_uri' opening (and caching) it if necessary.
+func (idx *Index) openBucket(ctx context.Context, bucket_uri string) (*blob.Bucket, error) {
+
+	idx.bucketsMu.Lock()
+	defer idx.bucketsMu.Unlock()
+
+	b, exists := idx.buckets[bucket_uri]
+
+	if exists {
+		return b, nil
 	}
 
-	return b.NewReader(ctx, f.Path, nil)
+	b, err := bucket.OpenBucket(ctx, bucket_uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	idx.buckets[bucket_uri] = b
+	return b, nil
 }
 
+// IdToFile returns the `File` record for the document 'id' or nil if there is no such document.
 func (idx *Index) IdToFile(id uint32) *File {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if int(id) >= len(idx.idToFile) {
+		return nil
+	}
+
 	return idx.idToFile[id]
 }
 
+// Archive returns a snapshot of the index suitable for serializing.
 func (idx *Index) Archive() *Archive {
 
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	bucket_uris := make(map[string]uint32)
+
+	for uri, id := range idx.bucketURIs {
+		bucket_uris[uri] = id
+	}
+
 	a := &Archive{
-		BloomFilter: idx.bloomFilter,
-		IdToFile:    idx.idToFile,
-		BucketURIs:  idx.bucketURIs,
+		Header:      newArchiveHeader(idx),
+		BloomFilter: slices.Clone(idx.bloomFilter),
+		IdToFile:    slices.Clone(idx.idToFile),
+		BucketURIs:  bucket_uris,
+		Tombstones:  idx.tombstoneIds(),
 	}
 
 	return a
 }
 
+// ExportArchiveWithURI writes the index to 'archive_uri'. Archives will be compressed if 'archive_uri' has a
+// "compression" query parameter (whose value is "gzip", "zstd" or "none") or, failing that, if its file extension
+// is ".gz" or ".zst".
 func (idx *Index) ExportArchiveWithURI(ctx context.Context, archive_uri string) error {
 
+	archive_uri, compression, err := deriveArchiveCompression(archive_uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive compression for archive URI, %w", err)
+	}
+
 	b, key, err := deriveBucketAndKey(ctx, archive_uri)
 
 	if err != nil {
@@ -405,24 +890,62 @@ func (idx *Index) ExportArchiveWithURI(ctx context.Context, archive_uri string)
 		return fmt.Errorf("Failed to create new writer for archive, %w", err)
 	}
 
-	err = idx.ExportArchive(ctx, wr)
+	cwr, err := newCompressionWriter(wr, compression)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create compression writer for archive, %w", err)
+	}
+
+	format := archiveFormatForKey(trimCompressionExtension(key), idx.archiveFormat)
+
+	err = idx.ExportArchiveWithFormat(ctx, cwr, format)
 
 	if err != nil {
 		return fmt.Errorf("Failed to export archive, %w", err)
 	}
 
+	err = cwr.Close()
+
+	if err != nil {
+		return fmt.Errorf("Failed to close compression writer for archive, %w", err)
+	}
+
 	return wr.Close()
 }
 
+// ExportArchive writes the index to 'wr' using the archive format the index was configured with.
 func (idx *Index) ExportArchive(ctx context.Context, wr io.Writer) error {
+	return idx.ExportArchiveWithFormat(ctx, wr, idx.archiveFormat)
+}
+
+// ExportArchiveWithFormat writes the index to 'wr' using the archive format 'format'.
+func (idx *Index) ExportArchiveWithFormat(ctx context.Context, wr io.Writer, format string) error {
 
 	a := idx.Archive()
-	enc := json.NewEncoder(wr)
-	return enc.Encode(a)
+
+	switch format {
+	case ArchiveFormatBinary:
+		return encodeBinaryArchive(a, wr)
+	case ArchiveFormatJSON, "":
+		enc := json.NewEncoder(wr)
+		return enc.Encode(a)
+	default:
+		return fmt.Errorf("Unsupported archive format '%s'", format)
+	}
 }
 
+// ImportArchiveWithURI reads the archive at 'archive_uri' in to the index. Compressed archives are detected automatically.
 func (idx *Index) ImportArchiveWithURI(ctx context.Context, archive_uri string) error {
 
+	// any compression query parameter needs to be removed before opening the bucket but is
+	// otherwise ignored since ImportArchive will detect compressed archives on its own
+
+	archive_uri, _, err := deriveArchiveCompression(archive_uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to parse archive URI, %w", err)
+	}
+
 	b, key, err := deriveBucketAndKey(ctx, archive_uri)
 
 	if err != nil {
@@ -447,13 +970,88 @@ func (idx *Index) ImportArchive(ctx context.Context, r io.Reader) error {
 
 	var a *Archive
 
-	dec := json.NewDecoder(r)
-	err := dec.Decode(&a)
+	// the archive compression and format are detected automatically
+
+	dr, err := newDecompressionReader(r)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create decompression reader, %w", err)
+	}
+
+	defer dr.Close()
+
+	br := bufio.NewReader(dr)
+
+	if isBinaryArchive(br) {
+		a, err = decodeBinaryArchive(br)
+	} else {
+		dec := json.NewDecoder(br)
+		err = dec.Decode(&a)
+	}
 
 	if err != nil {
 		return err
 	}
 
+	var tokenizer Tokenizer
+
+	// archives without a header are assumed to use the index's bloom filter parameters
+	bloom_size, bloom_hashes := idx.bloomParameters()
+
+	// documents added using Add don't have a file record so the number of documents in the bloom
+	// filter may be larger than the number of files, if the archive records it
+	count := len(a.IdToFile)
+
+	if a.Header != nil {
+
+		err := a.Header.Validate()
+
+		if err != nil {
+			return err
+		}
+
+		tokenizer, err = tokenizerForArchiveHeader(ctx, a.Header)
+
+		if err != nil {
+			return err
+		}
+
+		bloom_size = a.Header.BloomSize
+		bloom_hashes = len(a.Header.HashFunctions)
+
+		// archives with a term table may list more hash functions than the index was configured with
+		if a.Header.BloomHashes > 0 {
+			bloom_hashes = a.Header.BloomHashes
+		}
+
+		if a.Header.DocumentCount > count {
+			count = a.Header.DocumentCount
+		}
+	}
+
+	err = a.validateData(count, bloom_size)
+
+	if err != nil {
+		return err
+	}
+
+	idx.writerMu.Lock()
+	defer idx.writerMu.Unlock()
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if a.Header != nil {
+		idx.tokenizer = tokenizer
+		idx.maxBytes = a.Header.MaxBytes
+		idx.bloomSize = bloom_size
+		idx.bloomHashes = bloom_hashes
+		idx.termTable = a.Header.TermTable
+	} else {
+		// archives without a header don't contain the tokens spanning adjacent words that phrase queries depend on
+		idx.tokenizer = withoutPhraseTokens(idx.tokenizer)
+	}
+
 	for _, id := range a.BucketURIs {
 		max := math.Max(float64(id), float64(atomic.LoadUint32(&idx.maxBucketId)))
 		atomic.StoreUint32(&idx.maxBucketId, uint32(max))
@@ -462,12 +1060,43 @@ func (idx *Index) ImportArchive(ctx context.Context, r io.Reader) error {
 	idx.bloomFilter = a.BloomFilter
 	idx.idToFile = a.IdToFile
 	idx.bucketURIs = a.BucketURIs
+	idx.generation += 1
+
+	if idx.bloomFilter == nil {
+		idx.bloomFilter = make([]uint64, 0)
+	}
+
+	if idx.idToFile == nil {
+		idx.idToFile = make([]*File, 0)
+	}
+
+	if idx.bucketURIs == nil {
+		idx.bucketURIs = make(map[string]uint32)
+	}
+
+	// derive the block cursors used by Add so that new documents can be appended to the imported index
+	// (the bloom filter length has already been checked so this won't fail)
+
+	err = idx.deriveCursors(count)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive document cursors from archive, %w", err)
+	}
+
+	idx.tombstones = make(map[uint32]bool)
+
+	for _, id := range a.Tombstones {
+		idx.tombstones[id] = true
+	}
 
 	return nil
 }
 
 func (idx *Index) Close() error {
 
+	idx.bucketsMu.Lock()
+	defer idx.bucketsMu.Unlock()
+
 	for _, b := range idx.buckets {
 		b.Close()
 	}
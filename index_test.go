@@ -0,0 +1,413 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	_ "gocloud.dev/blob/fileblob"
+)
+
+// newTestBucket writes 'files', keyed by path, to a temporary directory and returns the URI of that directory.
+func newTestBucket(t *testing.T, files map[string]string) string {
+
+	t.Helper()
+
+	root := t.TempDir()
+
+	for path, body := range files {
+
+		abs_path := filepath.Join(root, filepath.FromSlash(path))
+
+		err := os.MkdirAll(filepath.Dir(abs_path), 0755)
+
+		if err != nil {
+			t.Fatalf("Failed to create directory for %s, %v", path, err)
+		}
+
+		err = os.WriteFile(abs_path, []byte(body), 0644)
+
+		if err != nil {
+			t.Fatalf("Failed to write %s, %v", path, err)
+		}
+	}
+
+	return "file://" + filepath.ToSlash(root)
+}
+
+// newTestIndex writes 'files', keyed by path, to a temporary directory and returns a new index, created using 'opts', of
+// that directory along with the URI of the directory.
+func newTestIndex(t *testing.T, opts *IndexOptions, files map[string]string) (*Index, string) {
+
+	t.Helper()
+
+	uri := newTestBucket(t, files)
+
+	idx := NewIndexWithOptions(opts)
+	t.Cleanup(func() { idx.Close() })
+
+	err := idx.IndexBuckets(context.Background(), uri)
+
+	if err != nil {
+		t.Fatalf("Failed to index %s, %v", uri, err)
+	}
+
+	return idx, uri
+}
+
+// queryPaths returns the paths of the documents in 'idx' which match the query 'q', in document id order.
+func queryPaths(t *testing.T, idx *Index, q string) []string {
+
+	t.Helper()
+
+	results, err := idx.Query(context.Background(), q, DefaultQueryOptions())
+
+	if err != nil {
+		t.Fatalf("Failed to query index for '%s', %v", q, err)
+	}
+
+	paths := make([]string, len(results))
+
+	for i, r := range results {
+		paths[i] = r.File.Path
+	}
+
+	return paths
+}
+
+func TestFileUnmarshalJSON(t *testing.T) {
+
+	tests := map[string]uint32{
+		`{"path":"a.txt","bucket_id":3}`: 3,
+		`{"path":"a.txt","BucketId":3}`:  3,
+		`{"path":"a.txt"}`:               0,
+	}
+
+	for enc, expected := range tests {
+
+		var f *File
+
+		err := json.Unmarshal([]byte(enc), &f)
+
+		if err != nil {
+			t.Fatalf("Failed to decode %s, %v", enc, err)
+		}
+
+		if f.Path != "a.txt" {
+			t.Fatalf("Unexpected path for %s: %s", enc, f.Path)
+		}
+
+		if f.BucketId != expected {
+			t.Fatalf("Unexpected bucket id for %s: %d (expected %d)", enc, f.BucketId, expected)
+		}
+	}
+}
+
+func TestArchiveUnmarshalLegacyBucketId(t *testing.T) {
+
+	enc := `{"bloom_filter":[],"id_to_file":[{"path":"a.txt","BucketId":3}],"bucket_uris":{"file:///a":0,"file:///b":3}}`
+
+	var a *Archive
+
+	err := json.Unmarshal([]byte(enc), &a)
+
+	if err != nil {
+		t.Fatalf("Failed to decode archive, %v", err)
+	}
+
+	if len(a.IdToFile) != 1 || a.IdToFile[0].BucketId != 3 {
+		t.Fatalf("Legacy bucket id was not decoded")
+	}
+}
+
+func TestAddAfterIndexing(t *testing.T) {
+
+	ctx := context.Background()
+
+	idx, uri := newTestIndex(t, DefaultIndexOptions(), map[string]string{
+		"a.txt": "hello world",
+		"b.txt": "goodbye world",
+	})
+
+	for _, text := range []string{"hello moon", "goodbye moon"} {
+
+		err := idx.Add(Itemise(idx.Tokenize(text)))
+
+		if err != nil {
+			t.Fatalf("Failed to add document, %v", err)
+		}
+	}
+
+	ids := idx.Search(idx.Queryise("moon"))
+
+	if !slices.Equal(ids, []uint32{2, 3}) {
+		t.Fatalf("Unexpected results for Search: %v", ids)
+	}
+
+	node, err := ParseQuery("hello")
+
+	if err != nil {
+		t.Fatalf("Failed to parse query, %v", err)
+	}
+
+	ids, err = idx.SearchQuery(node)
+
+	if err != nil {
+		t.Fatalf("Failed to search query, %v", err)
+	}
+
+	if !slices.Equal(ids, []uint32{0, 2}) {
+		t.Fatalf("Unexpected results for SearchQuery: %v", ids)
+	}
+
+	if idx.Statistics().Documents != 4 {
+		t.Fatalf("Unexpected number of documents: %d", idx.Statistics().Documents)
+	}
+
+	// documents without a file record can't be verified
+
+	results, err := idx.Query(ctx, "hello", DefaultQueryOptions())
+
+	if err != nil {
+		t.Fatalf("Failed to query index, %v", err)
+	}
+
+	if len(results) != 1 || results[0].File.Path != "a.txt" {
+		t.Fatalf("Unexpected results for Query: %v", results)
+	}
+
+	err = idx.Remove(2)
+
+	if err != nil {
+		t.Fatalf("Failed to remove added document, %v", err)
+	}
+
+	err = idx.Compact()
+
+	if err != nil {
+		t.Fatalf("Failed to compact index, %v", err)
+	}
+
+	ids = idx.Search(idx.Queryise("moon"))
+
+	if !slices.Equal(ids, []uint32{2}) || idx.Statistics().Documents != 3 {
+		t.Fatalf("Unexpected results after compacting index: %v", ids)
+	}
+
+	// file records are looked up by id so files can't be indexed after documents without one
+
+	err = idx.IndexBuckets(ctx, uri)
+
+	if err == nil {
+		t.Fatalf("Expected error indexing files after adding documents")
+	}
+}
+
+func TestArchiveWithoutFileRecords(t *testing.T) {
+
+	ctx := context.Background()
+
+	idx := NewIndex()
+
+	for _, text := range []string{"hello world", "goodbye world"} {
+
+		err := idx.Add(Itemise(idx.Tokenize(text)))
+
+		if err != nil {
+			t.Fatalf("Failed to add document, %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+
+	err := idx.ExportArchive(ctx, &buf)
+
+	if err != nil {
+		t.Fatalf("Failed to export archive, %v", err)
+	}
+
+	imported := NewIndex()
+
+	err = imported.ImportArchive(ctx, &buf)
+
+	if err != nil {
+		t.Fatalf("Failed to import archive, %v", err)
+	}
+
+	ids := imported.Search(imported.Queryise("goodbye"))
+
+	if len(ids) != 1 || ids[0] != 1 {
+		t.Fatalf("Unexpected results for imported archive: %v", ids)
+	}
+
+	// documents added after the import are appended to the existing ones
+
+	err = imported.Add(Itemise(imported.Tokenize("goodbye moon")))
+
+	if err != nil {
+		t.Fatalf("Failed to add document, %v", err)
+	}
+
+	ids = imported.Search(imported.Queryise("goodbye"))
+
+	if len(ids) != 2 || ids[1] != 2 {
+		t.Fatalf("Unexpected results after adding document: %v", ids)
+	}
+}
+
+func TestArchiveBloomHashes(t *testing.T) {
+
+	ctx := context.Background()
+
+	opts := DefaultIndexOptions()
+	opts.BloomHashes = 3
+	opts.TermTable = &TermTable{
+		Hashes:        map[string]int{"hel": 2},
+		DefaultHashes: 5,
+	}
+
+	idx, _ := newTestIndex(t, opts, map[string]string{
+		"a.txt": "hello world",
+	})
+
+	var buf bytes.Buffer
+
+	err := idx.ExportArchive(ctx, &buf)
+
+	if err != nil {
+		t.Fatalf("Failed to export archive, %v", err)
+	}
+
+	imported := NewIndex()
+
+	err = imported.ImportArchive(ctx, &buf)
+
+	if err != nil {
+		t.Fatalf("Failed to import archive, %v", err)
+	}
+
+	// the archive lists every hash function used by the term table but the index is still configured with 3
+
+	a := imported.Archive()
+
+	if len(a.Header.HashFunctions) != 5 || a.Header.BloomHashes != 3 {
+		t.Fatalf("Unexpected hash functions in archive header: %v, %d", a.Header.HashFunctions, a.Header.BloomHashes)
+	}
+
+	s := imported.Statistics()
+
+	if s.BloomHashes != 3 {
+		t.Fatalf("Unexpected number of hash functions for imported index: %d", s.BloomHashes)
+	}
+
+	// archives written before the number of hash functions was recorded use the number of hash functions listed
+
+	a.Header.BloomHashes = 0
+	a.Header.TermTable = nil
+
+	enc, err := json.Marshal(a)
+
+	if err != nil {
+		t.Fatalf("Failed to encode archive, %v", err)
+	}
+
+	legacy := NewIndex()
+
+	err = legacy.ImportArchive(ctx, bytes.NewReader(enc))
+
+	if err != nil {
+		t.Fatalf("Failed to import legacy archive, %v", err)
+	}
+
+	if legacy.Statistics().BloomHashes != 5 {
+		t.Fatalf("Unexpected number of hash functions for legacy archive: %d", legacy.Statistics().BloomHashes)
+	}
+}
+
+func TestImportArchiveMissingFileRecord(t *testing.T) {
+
+	bloom_filter := make([]string, BloomSize)
+
+	for i := range bloom_filter {
+		bloom_filter[i] = "1"
+	}
+
+	enc := `{"bloom_filter":[` + strings.Join(bloom_filter, ",") + `],"id_to_file":[null],"bucket_uris":{}}`
+
+	err := NewIndex().ImportArchive(context.Background(), strings.NewReader(enc))
+
+	var incompatible *IncompatibleArchiveError
+
+	if !errors.As(err, &incompatible) || incompatible.Property != "id_to_file" {
+		t.Fatalf("Expected IncompatibleArchiveError for missing file record, got %v", err)
+	}
+}
+
+func TestImportArchiveInconsistentData(t *testing.T) {
+
+	idx, _ := newTestIndex(t, DefaultIndexOptions(), map[string]string{
+		"a.txt": "hello world",
+		"b.txt": "goodbye world",
+	})
+
+	tests := map[string]func(*Archive){
+		"bloom_filter": func(a *Archive) {
+			a.BloomFilter = a.BloomFilter[:len(a.BloomFilter)-1]
+		},
+		"id_to_file": func(a *Archive) {
+			a.IdToFile[1] = nil
+		},
+		"tombstones": func(a *Archive) {
+			a.Tombstones = []uint32{2}
+		},
+	}
+
+	for property, corrupt := range tests {
+
+		a := idx.Archive()
+		corrupt(a)
+
+		enc, err := json.Marshal(a)
+
+		if err != nil {
+			t.Fatalf("Failed to encode archive, %v", err)
+		}
+
+		err = NewIndex().ImportArchive(context.Background(), bytes.NewReader(enc))
+
+		var incompatible *IncompatibleArchiveError
+
+		if !errors.As(err, &incompatible) || incompatible.Property != property {
+			t.Fatalf("Expected IncompatibleArchiveError for %s, got %v", property, err)
+		}
+	}
+
+	// tombstones for documents without a file record are valid if the archive records the number of documents
+
+	err := idx.Add(idx.Itemise(idx.Tokenize("hello moon")))
+
+	if err != nil {
+		t.Fatalf("Failed to add document, %v", err)
+	}
+
+	a := idx.Archive()
+	a.Tombstones = []uint32{2}
+
+	enc, err := json.Marshal(a)
+
+	if err != nil {
+		t.Fatalf("Failed to encode archive, %v", err)
+	}
+
+	err = NewIndex().ImportArchive(context.Background(), bytes.NewReader(enc))
+
+	if err != nil {
+		t.Fatalf("Failed to import archive, %v", err)
+	}
+}
@@ -6,10 +6,17 @@ import (
 )
 
 const (
-	BloomSize         = 4096
+	// BloomSize is the default number of bits in the bloom filter for each document.
+	BloomSize = 4096
+	// BloomHashes is the default number of hash functions used to derive the bloom filter positions for each token.
+	BloomHashes = 3
+	// DocumentsPerBlock is the number of documents stored in each bloom filter block, one for each bit of a uint64.
 	DocumentsPerBlock = 64
 )
 
+// The maximum number of hash functions used to derive the bloom filter positions for each token.
+const maxBloomHashes = 16
+
 // Ngrams given input splits it according the requested size
 // such that you can get trigrams or whatever else is required
 func Ngrams(text string, size int) []string {
@@ -37,33 +44,51 @@ func GetFill(doc []bool) float64 {
 		}
 	}
 
-	return float64(count) / float64(BloomSize) * 100
+	return float64(count) / float64(len(doc)) * 100
 }
 
 // HashBloom hashes a single token/word 3 times to give us the entry
 // locations we need for our bloomFilter filter
 func HashBloom(word []byte) []uint64 {
-	var hashes []uint64
+	return HashBloomWithSize(word, BloomSize, BloomHashes)
+}
+
+// HashBloomWithSize hashes a single token/word 'count' times to give us the
+// entry locations we need for a bloom filter with 'size' bits. The first 3
+// hashes are the same as those returned by `HashBloom` (for the same size)
+// and any others are derived from the first two using double hashing.
+func HashBloomWithSize(word []byte, size int, count int) []uint64 {
+	hashes := make([]uint64, 0, count)
 
 	h1 := fnv.New64a()
 	h2 := fnv.New64()
 
-	// 3 hashes is probably OK for our purposes
-	// but to be really like Bing it should change this
-	// based on how common/rare the term is where
-	// rarer terms are hashes more
+	// like Bing the number of hashes can depend on how
+	// common/rare the term is, rarer terms being hashed
+	// more, see `TermTable` for how 'count' is chosen
 
 	_, _ = h1.Write(word)
-	hashes = append(hashes, h1.Sum64()%BloomSize)
-	h1.Reset()
+	a := h1.Sum64()
 
 	_, _ = h2.Write(word)
-	hashes = append(hashes, h2.Sum64()%BloomSize)
+	b := h2.Sum64()
 
-	_, _ = h1.Write(word)
-	_, _ = h1.Write([]byte("salt")) // anything works here
-	hashes = append(hashes, h1.Sum64()%BloomSize)
-	h1.Reset()
+	if count > 0 {
+		hashes = append(hashes, a%uint64(size))
+	}
+
+	if count > 1 {
+		hashes = append(hashes, b%uint64(size))
+	}
+
+	if count > 2 {
+		_, _ = h1.Write([]byte("salt")) // anything works here
+		hashes = append(hashes, h1.Sum64()%uint64(size))
+	}
+
+	for i := 3; i < count; i++ {
+		hashes = append(hashes, (a+uint64(i)*b)%uint64(size))
+	}
 
 	return hashes
 }
@@ -4,16 +4,30 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Given a file and a query try to open the file, then look through its lines
 // and see if any of them match something from the query up to a limit
-// Note this will return partial matches as if any term matches its considered a match
-// and there is no accounting for better matches...
+// The query is parsed using `ParseQuery` and if the file as a whole does not match
+// the query no lines are returned. Otherwise any line containing a term or phrase which
+// is not negated is considered a match and there is no accounting for better matches...
 // In other words it's a very dumb way of doing this and probably has horrible runtime
 // performance to match
 func FindMatchingLines(r io.Reader, query string, limit int) []string {
+	return findMatchingLines(r, query, limit, strings.ToLower)
+}
+
+// FindMatchingLines is like the package-level `FindMatchingLines` function except that terms and phrases are matched
+// against text normalized by the index's `Tokenizer`, as they are when verifying search results.
+func (idx *Index) FindMatchingLines(r io.Reader, query string, limit int) []string {
+	return findMatchingLines(r, query, limit, idx.Tokenizer().Normalize)
+}
+
+func findMatchingLines(r io.Reader, query string, limit int, normalize func(string) string) []string {
 
 	var matches []string
 
@@ -24,25 +38,25 @@ func FindMatchingLines(r io.Reader, query string, limit int) []string {
 		return matches
 	}
 
-	terms := strings.Fields(strings.ToLower(query))
-	var cleanTerms []string
-	for _, t := range terms {
-		if len(t) >= 3 {
-			cleanTerms = append(cleanTerms, t)
-		}
+	node, err := ParseQuery(query)
+
+	if err != nil {
+		slog.Error("Failed to parse query", "query", query, "error", err)
+		return matches
 	}
 
-	for i, l := range strings.Split(string(res), "\n") {
+	m := newQueryMatcher(node, normalize)
 
-		low := strings.ToLower(l)
-		found := false
-		for _, t := range terms {
-			if strings.Contains(low, t) {
-				if !found {
-					matches = append(matches, fmt.Sprintf("%v. %v", i+1, l))
-				}
-				found = true
-			}
+	body := string(res)
+
+	if !m.matchesDocument(body, m.normalize(body)) {
+		return matches
+	}
+
+	for i, l := range strings.Split(body, "\n") {
+
+		if m.matchLine(l) != -1 {
+			matches = append(matches, fmt.Sprintf("%v. %v", i+1, l))
 		}
 
 		if len(matches) >= limit {
@@ -52,3 +66,330 @@ func FindMatchingLines(r io.Reader, query string, limit int) []string {
 
 	return matches
 }
+
+// DocumentMatchesQuery reports whether 'body' satisfies 'node'. Terms are matched case-insensitively
+// and phrases are matched case-insensitively unless they are flagged as being case-sensitive.
+func DocumentMatchesQuery(node QueryNode, body string) bool {
+	m := newQueryMatcher(node, strings.ToLower)
+	return m.matchesDocument(body, m.normalize(body))
+}
+
+// leafMatcher matches a single term, phrase or regular expression.
+type leafMatcher struct {
+	// node is the query used to estimate the number of documents matched by 're' using the bloom filter.
+	node QueryNode
+	re   *regexp.Regexp
+	// normalized signals that 're' should be matched against normalized text.
+	normalized bool
+}
+
+// newLeafMatcher returns a `leafMatcher` for the `TermNode` or `PhraseNode` 'node' whose text is normalized using 'normalize'.
+func newLeafMatcher(node QueryNode, normalize func(string) string) *leafMatcher {
+
+	l := &leafMatcher{
+		node:       node,
+		normalized: true,
+	}
+
+	switch n := node.(type) {
+	case *TermNode:
+		// normalization may turn leading or trailing punctuation in to whitespace
+		l.re = regexp.MustCompile(regexp.QuoteMeta(strings.TrimSpace(normalize(n.Term))))
+	case *PhraseNode:
+
+		if n.CaseSensitive {
+			l.re = n.Regexp()
+			l.normalized = false
+			break
+		}
+
+		words := strings.Fields(normalize(n.Phrase))
+
+		for i, w := range words {
+			words[i] = regexp.QuoteMeta(w)
+		}
+
+		l.re = regexp.MustCompile(strings.Join(words, phraseSeparator))
+	}
+
+	return l
+}
+
+// text returns either 'text' or its normalized equivalent 'normalized' depending on which one 'l' should be matched against.
+func (l *leafMatcher) text(text string, normalized string) string {
+
+	if l.normalized {
+		return normalized
+	}
+
+	return text
+}
+
+// queryMatcher verifies documents, and finds the matching lines in those documents, for a query.
+type queryMatcher struct {
+	// node is the query which documents must satisfy. If nil documents must contain at least one line matched by positive.
+	node QueryNode
+	// normalize is the function used to normalize text before it is matched against terms and phrases.
+	normalize func(string) string
+	leaves    map[QueryNode]*leafMatcher
+	// positive are the matchers for the terms and phrases which are not negated; these are used to find matching lines.
+	positive []*leafMatcher
+	// scorer is the (optional) `resultScorer` used to score documents verified using the matcher.
+	scorer *resultScorer
+}
+
+// newQueryMatcher returns a `queryMatcher` for 'node' whose terms and phrases are matched against text normalized using 'normalize'.
+func newQueryMatcher(node QueryNode, normalize func(string) string) *queryMatcher {
+
+	m := &queryMatcher{
+		node:      node,
+		normalize: normalize,
+		leaves:    make(map[QueryNode]*leafMatcher),
+		positive:  make([]*leafMatcher, 0),
+	}
+
+	var walk func(QueryNode, bool)
+
+	walk = func(node QueryNode, negated bool) {
+
+		switch n := node.(type) {
+		case *TermNode, *PhraseNode:
+
+			l := newLeafMatcher(n, normalize)
+			m.leaves[n] = l
+
+			if !negated {
+				m.positive = append(m.positive, l)
+			}
+
+		case *AndNode:
+
+			for _, child := range n.Nodes {
+				walk(child, negated)
+			}
+
+		case *OrNode:
+
+			for _, child := range n.Nodes {
+				walk(child, negated)
+			}
+
+		case *NotNode:
+			walk(n.Node, !negated)
+		}
+	}
+
+	walk(node, false)
+	return m
+}
+
+// newRegexpMatcher returns a `queryMatcher` for documents containing lines matched by 're' where 'node' is the query
+// used to estimate the number of documents matched by 're'.
+func newRegexpMatcher(re *regexp.Regexp, node QueryNode, normalize func(string) string) *queryMatcher {
+
+	l := &leafMatcher{
+		node: node,
+		re:   re,
+	}
+
+	m := &queryMatcher{
+		normalize: normalize,
+		leaves:    make(map[QueryNode]*leafMatcher),
+		positive:  []*leafMatcher{l},
+	}
+
+	return m
+}
+
+// matchesDocument reports whether 'body', whose normalized equivalent is 'normalized', satisfies the matcher's query.
+func (m *queryMatcher) matchesDocument(body string, normalized string) bool {
+
+	if m.node == nil {
+		return true
+	}
+
+	return m.matchesNode(m.node, body, normalized)
+}
+
+func (m *queryMatcher) matchesNode(node QueryNode, body string, normalized string) bool {
+
+	switch n := node.(type) {
+	case *TermNode, *PhraseNode:
+		l := m.leaves[n]
+		return l.re.MatchString(l.text(body, normalized))
+	case *AndNode:
+
+		for _, child := range n.Nodes {
+
+			if !m.matchesNode(child, body, normalized) {
+				return false
+			}
+		}
+
+		return true
+
+	case *OrNode:
+
+		for _, child := range n.Nodes {
+
+			if m.matchesNode(child, body, normalized) {
+				return true
+			}
+		}
+
+		return false
+
+	case *NotNode:
+		return !m.matchesNode(n.Node, body, normalized)
+	default:
+		return false
+	}
+}
+
+// matchLine returns the byte offset of the first match in 'line' for any term, phrase or regular expression which is not
+// negated or -1 if there are no matches.
+func (m *queryMatcher) matchLine(line string) int {
+
+	first := -1
+
+	normalized := ""
+	has_normalized := false
+
+	var offsets []int
+
+	for _, l := range m.positive {
+
+		if l.normalized && !has_normalized {
+			normalized = m.normalize(line)
+			has_normalized = true
+		}
+
+		loc := l.re.FindStringIndex(l.text(line, normalized))
+
+		if loc == nil {
+			continue
+		}
+
+		pos := loc[0]
+
+		if l.normalized {
+
+			if offsets == nil {
+				offsets = normalizedOffsets(line, normalized, m.normalize)
+			}
+
+			pos = offsets[pos]
+		}
+
+		if first == -1 || pos < first {
+			first = pos
+		}
+	}
+
+	return first
+}
+
+// normalizedOffsets returns a slice mapping each byte offset in 'normalized', the equivalent of 'text' normalized using
+// 'normalize', to a byte offset in 'text'. Normalization may change the length of text (for example by expanding ligatures,
+// composing accents or stemming words) so the mapping is built by normalizing 'text' one word at a time, and each word one
+// character at a time if that yields the same result as normalizing the whole word, and recording where the normalized
+// equivalent of each piece came from. Offsets inside a word which can't be normalized one character at a time are mapped to
+// the first character which differs from its normalized equivalent. If normalizing 'text' piece by piece doesn't yield
+// 'normalized' then every offset is mapped to 0.
+func normalizedOffsets(text string, normalized string, normalize func(string) string) []int {
+
+	offsets := make([]int, 0, len(normalized)+1)
+
+	if text == normalized {
+
+		for i := 0; i <= len(text); i++ {
+			offsets = append(offsets, i)
+		}
+
+		return offsets
+	}
+
+	var sb strings.Builder
+
+	add := func(offset int, piece string) {
+		sb.WriteString(piece)
+
+		for i := 0; i < len(piece); i++ {
+			offsets = append(offsets, offset)
+		}
+	}
+
+	for start := 0; start < len(text); {
+
+		// words are runs of characters which are (or are not) whitespace
+
+		r, _ := utf8.DecodeRuneInString(text[start:])
+		space := unicode.IsSpace(r)
+
+		end := start
+
+		for end < len(text) {
+
+			r, sz := utf8.DecodeRuneInString(text[end:])
+
+			if unicode.IsSpace(r) != space {
+				break
+			}
+
+			end += sz
+		}
+
+		word := text[start:end]
+		normalized_word := normalize(word)
+
+		chars := make([]string, 0, len(word))
+
+		for _, r := range word {
+			chars = append(chars, normalize(string(r)))
+		}
+
+		if strings.Join(chars, "") == normalized_word {
+
+			n := 0
+
+			for i := range word {
+				add(start+i, chars[n])
+				n += 1
+			}
+
+		} else {
+
+			// map the (byte-wise) common prefix of the word and its normalized equivalent directly
+			prefix := 0
+
+			for prefix < len(word) && prefix < len(normalized_word) && word[prefix] == normalized_word[prefix] {
+				prefix++
+			}
+
+			for prefix > 0 && prefix < len(word) && !utf8.RuneStart(word[prefix]) {
+				prefix--
+			}
+
+			for i := 0; i < prefix; i++ {
+				add(start+i, normalized_word[i:i+1])
+			}
+
+			add(start+prefix, normalized_word[prefix:])
+		}
+
+		start = end
+	}
+
+	if sb.String() != normalized {
+
+		offsets = offsets[:0]
+
+		for i := 0; i <= len(normalized); i++ {
+			offsets = append(offsets, 0)
+		}
+
+		return offsets
+	}
+
+	return append(offsets, len(text))
+}
@@ -0,0 +1,259 @@
+package indexer
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// matchOffsetTest is a query, and the document it is searched against, along with the expected position of the first match.
+type matchOffsetTest struct {
+	body       string
+	query      string
+	line       int
+	column     int
+	byteOffset int64
+}
+
+// testMatchOffsets indexes the document for each test in 'tests', using the tokenizer 'uri', and ensures that the first match for
+// each query is reported at the expected position.
+func testMatchOffsets(t *testing.T, uri string, tests []matchOffsetTest) {
+
+	t.Helper()
+
+	ctx := context.Background()
+
+	tokenizer, err := NewTokenizer(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create tokenizer for %s, %v", uri, err)
+	}
+
+	for _, test := range tests {
+
+		opts := DefaultIndexOptions()
+		opts.Tokenizer = tokenizer
+
+		idx, _ := newTestIndex(t, opts, map[string]string{
+			"doc.txt": test.body,
+		})
+
+		results, err := idx.Query(ctx, test.query, DefaultQueryOptions())
+
+		if err != nil {
+			t.Fatalf("Failed to query '%s', %v", test.query, err)
+		}
+
+		if len(results) != 1 || len(results[0].Matches) == 0 {
+			t.Fatalf("Expected a match for '%s' in %q using %s", test.query, test.body, uri)
+		}
+
+		m := results[0].Matches[0]
+
+		if m.Line != test.line || m.Column != test.column || m.ByteOffset != test.byteOffset {
+			t.Fatalf("Unexpected match for '%s' in %q using %s: line %d, column %d, byte offset %d (expected %d, %d, %d)", test.query, test.body, uri, m.Line, m.Column, m.ByteOffset, test.line, test.column, test.byteOffset)
+		}
+	}
+}
+
+func TestMatchOffsets(t *testing.T) {
+
+	tests := []matchOffsetTest{
+		{"hello new york", "york", 1, 11, 10},
+		{"Hello New York", "york", 1, 11, 10},
+		{"first line\nsecond line new york", "york", 2, 17, 27},
+		{"first line\r\nhello york", "york", 2, 7, 18},
+	}
+
+	testMatchOffsets(t, "trigram://", tests)
+}
+
+func TestMatchOffsetsUnicodeNormalization(t *testing.T) {
+
+	tests := []matchOffsetTest{
+		// ligatures are expanded by NFKC normalization
+		{"ﬁﬁﬁ new york", "york", 1, 9, 14},
+		{"ﬁﬁﬁ new york", "fififi", 1, 1, 0},
+		{"the deﬁnition of york", "finition", 1, 7, 6},
+		{"the deﬁnition of york", "york", 1, 18, 19},
+		// decomposed (NFD) characters are composed by NFKC normalization
+		{"cafe\u0301 new york", "york", 1, 11, 11},
+		{"cafe\u0301 new york", "caf\u00e9", 1, 1, 0},
+		{"new cafe\u0301", "caf\u00e9", 1, 5, 4},
+		{"\ufb01rst line\ncafe\u0301 new york", "york", 2, 11, 23},
+		// full-width characters are folded by NFKC normalization
+		{"ｙｏｒｋ new york", "new", 1, 6, 13},
+	}
+
+	testMatchOffsets(t, "trigram://?normalize=nfkc", tests)
+
+	tests = []matchOffsetTest{
+		// accents are removed
+		{"Cr\u00e8me br\u00fbl\u00e9e york", "brulee", 1, 7, 7},
+		{"Cr\u00e8me br\u00fbl\u00e9e york", "york", 1, 14, 16},
+		{"cre\u0300me bru\u0302le\u0301e york", "york", 1, 17, 19},
+		{"\ufb01\ufb01\ufb01 cr\u00e8me york", "york", 1, 11, 17},
+	}
+
+	testMatchOffsets(t, "trigram://?normalize=nfkc&fold=accents", tests)
+}
+
+func TestMatchOffsetsStemming(t *testing.T) {
+
+	tests := []matchOffsetTest{
+		// stemming shortens words so offsets after them must be mapped back to the original line
+		{"running walking jumping new york", "york", 1, 29, 28},
+		{"running walking jumping new york", "jumps", 1, 17, 16},
+		{"the ponies ran\nhopping happily to york", "york", 2, 20, 34},
+		{"caresses and hopefulness", "hopeful", 1, 14, 13},
+	}
+
+	testMatchOffsets(t, "trigram://?stem=en", tests)
+
+	tests = []matchOffsetTest{
+		{"the running of the new york marathon", "york", 1, 24, 23},
+		{"the running of the new york marathon", "\"new york\"", 1, 20, 19},
+	}
+
+	testMatchOffsets(t, "trigram://?stopwords=en&stem=en", tests)
+}
+
+func TestNormalizedOffsets(t *testing.T) {
+
+	tokenizer, err := NewTokenizer(context.Background(), "trigram://?normalize=nfkc&stem=en")
+
+	if err != nil {
+		t.Fatalf("Failed to create tokenizer, %v", err)
+	}
+
+	tests := []string{
+		"",
+		"hello",
+		"ﬁﬁﬁ new york",
+		"cafe\u0301  new\tyork ",
+		"ＡＢＣ ﬃ",
+		"running walking jumping new york",
+	}
+
+	for _, text := range tests {
+
+		normalized := tokenizer.Normalize(text)
+		offsets := normalizedOffsets(text, normalized, tokenizer.Normalize)
+
+		if len(offsets) != len(normalized)+1 {
+			t.Fatalf("Unexpected number of offsets for %q: %d (expected %d)", text, len(offsets), len(normalized)+1)
+		}
+
+		if offsets[len(normalized)] != len(text) {
+			t.Fatalf("Unexpected final offset for %q: %d (expected %d)", text, offsets[len(normalized)], len(text))
+		}
+
+		for i := 1; i < len(offsets); i++ {
+
+			if offsets[i] < offsets[i-1] {
+				t.Fatalf("Offsets for %q are not ordered: %v", text, offsets)
+			}
+		}
+	}
+}
+
+func TestPhraseSpanningLines(t *testing.T) {
+
+	ctx := context.Background()
+
+	idx, _ := newTestIndex(t, DefaultIndexOptions(), map[string]string{
+		"a.txt": "hello\nworld",
+		"b.txt": "hello \t world",
+		"c.txt": "hello\r\nworld",
+	})
+
+	for _, case_sensitive := range []bool{false, true} {
+
+		opts := DefaultQueryOptions()
+		opts.CaseSensitive = case_sensitive
+
+		results, err := idx.Query(ctx, `"hello world"`, opts)
+
+		if err != nil {
+			t.Fatalf("Failed to query index, %v", err)
+		}
+
+		// every result has a matching line
+
+		if len(results) != 1 || results[0].File.Path != "b.txt" || len(results[0].Matches) != 1 {
+			t.Fatalf("Unexpected results for phrase (case sensitive %t): %v", case_sensitive, results)
+		}
+	}
+
+	node := &PhraseNode{Phrase: "hello world"}
+
+	if DocumentMatchesQuery(node, "hello\nworld") {
+		t.Fatalf("Phrase should not match words on different lines")
+	}
+
+	lines := FindMatchingLines(strings.NewReader("hello\nworld"), `"hello world"`, 0)
+
+	if len(lines) != 0 {
+		t.Fatalf("Unexpected matching lines: %v", lines)
+	}
+}
+
+func TestMatchOffsetsAllLines(t *testing.T) {
+
+	ctx := context.Background()
+
+	// every match, not just the first one, is reported at its position in the original (un-normalized) text, both
+	// for composed and decomposed accented characters
+
+	tokenizer, err := NewTokenizer(ctx, "trigram://?normalize=nfkc&fold=accents&stem=en")
+
+	if err != nil {
+		t.Fatalf("Failed to create tokenizer, %v", err)
+	}
+
+	opts := DefaultIndexOptions()
+	opts.Tokenizer = tokenizer
+
+	lines := []string{
+		"Caf\u00e9s were running",
+		"nothing here",
+		"the \ufb01rst cafe\u0301 runs",
+	}
+
+	idx, _ := newTestIndex(t, opts, map[string]string{
+		"doc.txt": strings.Join(lines, "\n"),
+	})
+
+	tests := map[string][]*Match{
+		"cafe": {
+			{Line: 1, Column: 1, ByteOffset: 0},
+			{Line: 3, Column: 10, ByteOffset: 44},
+		},
+		"run": {
+			{Line: 1, Column: 12, ByteOffset: 12},
+			{Line: 3, Column: 16, ByteOffset: 51},
+		},
+	}
+
+	for q, expected := range tests {
+
+		results, err := idx.Query(ctx, q, DefaultQueryOptions())
+
+		if err != nil {
+			t.Fatalf("Failed to query '%s', %v", q, err)
+		}
+
+		if len(results) != 1 || len(results[0].Matches) != len(expected) {
+			t.Fatalf("Unexpected results for '%s': %v", q, results)
+		}
+
+		for i, m := range results[0].Matches {
+
+			e := expected[i]
+
+			if m.Line != e.Line || m.Column != e.Column || m.ByteOffset != e.ByteOffset || m.Text != lines[e.Line-1] {
+				t.Fatalf("Unexpected match %d for '%s': line %d, column %d, byte offset %d, %q (expected %d, %d, %d)", i, q, m.Line, m.Column, m.ByteOffset, m.Text, e.Line, e.Column, e.ByteOffset)
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package indexer
+
+import (
+	"context"
+	"sync"
+)
+
+// indexJob is a function which reads and tokenizes a single document. It returns a nil `indexedDocument`
+// if the document should be skipped.
+type indexJob func(context.Context) (*indexedDocument, error)
+
+// indexPipeline runs `indexJob` functions concurrently, using a fixed number of workers, and adds the
+// resulting documents to an index in the same order the jobs were submitted.
+type indexPipeline struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	target  *Index
+	workers chan bool
+	pending chan chan *indexJobResult
+	done    chan bool
+	err     error
+	errMu   sync.Mutex
+}
+
+type indexJobResult struct {
+	doc *indexedDocument
+	err error
+}
+
+// newIndexPipeline returns a new `indexPipeline` instance which adds documents to 'target' using 'workers'
+// concurrent workers. If 'workers' is less than one a single worker is used.
+func newIndexPipeline(ctx context.Context, target *Index, workers int) *indexPipeline {
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	p := &indexPipeline{
+		ctx:     ctx,
+		cancel:  cancel,
+		target:  target,
+		workers: make(chan bool, workers),
+		pending: make(chan chan *indexJobResult, workers*2),
+		done:    make(chan bool),
+	}
+
+	go p.commit()
+
+	return p
+}
+
+// Context returns the context for the pipeline which is cancelled if a job fails.
+func (p *indexPipeline) Context() context.Context {
+	return p.ctx
+}
+
+// Submit schedules 'job' to be run, blocking until a worker is available.
+func (p *indexPipeline) Submit(job indexJob) error {
+
+	select {
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	case p.workers <- true:
+		// pass
+	}
+
+	result_ch := make(chan *indexJobResult, 1)
+
+	go func() {
+
+		defer func() {
+			<-p.workers
+		}()
+
+		doc, err := job(p.ctx)
+
+		result_ch <- &indexJobResult{
+			doc: doc,
+			err: err,
+		}
+	}()
+
+	select {
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	case p.pending <- result_ch:
+		return nil
+	}
+}
+
+// Wait blocks until all the submitted jobs have completed and their documents have been added to the
+// target index, returning the first error encountered.
+func (p *indexPipeline) Wait() error {
+
+	close(p.pending)
+	<-p.done
+
+	p.cancel()
+
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+
+	return p.err
+}
+
+// commit adds the results of each job to the target index in the order they were submitted.
+func (p *indexPipeline) commit() {
+
+	defer close(p.done)
+
+	for result_ch := range p.pending {
+
+		rsp := <-result_ch
+
+		if p.failed() {
+			continue
+		}
+
+		err := rsp.err
+
+		if err == nil && rsp.doc != nil {
+			err = p.target.addDocument(rsp.doc)
+		}
+
+		if err != nil {
+			p.fail(err)
+		}
+	}
+}
+
+func (p *indexPipeline) failed() bool {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	return p.err != nil
+}
+
+func (p *indexPipeline) fail(err error) {
+
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+
+	if p.err == nil {
+		p.err = err
+		p.cancel()
+	}
+}
@@ -0,0 +1,71 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestIndexBucketsWorkersDeterministic(t *testing.T) {
+
+	// enough documents to span several blocks, some of which are skipped because they are binary files
+
+	files := make(map[string]string)
+
+	for i := 0; i < 200; i++ {
+
+		body := fmt.Sprintf("document %03d says hello", i)
+
+		if i%7 == 0 {
+			body = body + "\x00"
+		}
+
+		files[fmt.Sprintf("%02d/%03d.txt", i%10, i)] = body
+	}
+
+	uri := newTestBucket(t, files)
+
+	newIndex := func(workers int) *Index {
+
+		opts := DefaultIndexOptions()
+		opts.Workers = workers
+
+		idx := NewIndexWithOptions(opts)
+		t.Cleanup(func() { idx.Close() })
+
+		err := idx.IndexBuckets(context.Background(), uri)
+
+		if err != nil {
+			t.Fatalf("Failed to index %s with %d workers, %v", uri, workers, err)
+		}
+
+		return idx
+	}
+
+	expected := newIndex(1)
+
+	if expected.Statistics().Documents == 0 || expected.Statistics().Documents == len(files) {
+		t.Fatalf("Unexpected number of documents: %d", expected.Statistics().Documents)
+	}
+
+	for _, workers := range []int{2, 8, 32} {
+
+		idx := newIndex(workers)
+
+		if idx.currentDocumentCount != expected.currentDocumentCount {
+			t.Fatalf("Unexpected number of documents with %d workers: %d (expected %d)", workers, idx.currentDocumentCount, expected.currentDocumentCount)
+		}
+
+		for id, f := range expected.idToFile {
+
+			if idx.idToFile[id].Path != f.Path {
+				t.Fatalf("Unexpected file for document %d with %d workers: %s (expected %s)", id, workers, idx.idToFile[id].Path, f.Path)
+			}
+		}
+
+		if !slices.Equal(idx.bloomFilter, expected.bloomFilter) {
+			t.Fatalf("Bloom filter with %d workers differs from the bloom filter with 1 worker", workers)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package indexer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// QueryNode is a node in the abstract syntax tree of a parsed query.
+type QueryNode interface {
+	String() string
+}
+
+// TermNode is a `QueryNode` matching documents which contain a single term.
+type TermNode struct {
+	Term string
+}
+
+func (n *TermNode) String() string {
+	return n.Term
+}
+
+// phraseSeparator is the regular expression which matches the space between the words of a phrase: any whitespace
+// other than a newline.
+const phraseSeparator = `[^\S\n]+`
+
+// PhraseNode is a `QueryNode` matching documents which contain an exact sequence of words. Any amount
+// of whitespace in a document, other than a line break, matches the whitespace between words in the phrase.
+type PhraseNode struct {
+	Phrase string
+	// CaseSensitive signals that the phrase should be matched case-sensitively when documents are verified.
+	CaseSensitive bool
+	re            *regexp.Regexp
+	reOnce        sync.Once
+}
+
+func (n *PhraseNode) String() string {
+	return strconv.Quote(n.Phrase)
+}
+
+// Words returns the words in the phrase.
+func (n *PhraseNode) Words() []string {
+	return strings.Fields(n.Phrase)
+}
+
+// Regexp returns a regular expression matching the phrase where one or more whitespace characters,
+// other than newlines, match the space between each word in the phrase. Phrases are matched within
+// a single line so that every document which matches a phrase has a line which matches it.
+func (n *PhraseNode) Regexp() *regexp.Regexp {
+
+	n.reOnce.Do(func() {
+
+		words := n.Words()
+
+		for i, w := range words {
+			words[i] = regexp.QuoteMeta(w)
+		}
+
+		pattern := strings.Join(words, phraseSeparator)
+
+		if !n.CaseSensitive {
+			pattern = "(?i)" + pattern
+		}
+
+		n.re = regexp.MustCompile(pattern)
+	})
+
+	return n.re
+}
+
+// AndNode is a `QueryNode` matching documents which match all of its child nodes.
+type AndNode struct {
+	Nodes []QueryNode
+}
+
+func (n *AndNode) String() string {
+	return joinQueryNodes(n.Nodes, " ")
+}
+
+// OrNode is a `QueryNode` matching documents which match any of its child nodes.
+type OrNode struct {
+	Nodes []QueryNode
+}
+
+func (n *OrNode) String() string {
+	return joinQueryNodes(n.Nodes, " OR ")
+}
+
+// NotNode is a `QueryNode` matching documents which do not match its child node. Since the bloom filter can
+// only tell us which documents might contain a term, and not which documents definitely do not, negation is
+// only applied when candidate documents are verified against their content.
+type NotNode struct {
+	Node QueryNode
+}
+
+func (n *NotNode) String() string {
+	return "-" + n.Node.String()
+}
+
+func joinQueryNodes(nodes []QueryNode, sep string) string {
+
+	parts := make([]string, len(nodes))
+
+	for i, n := range nodes {
+
+		switch n.(type) {
+		case *AndNode, *OrNode:
+			parts[i] = "(" + n.String() + ")"
+		default:
+			parts[i] = n.String()
+		}
+	}
+
+	return strings.Join(parts, sep)
+}
+
+// ParseQueryOptions defines configuration options for parsing queries.
+type ParseQueryOptions struct {
+	// CaseSensitive signals that quoted phrases should be matched case-sensitively.
+	CaseSensitive bool
+}
+
+// DefaultParseQueryOptions returns a `ParseQueryOptions` instance with default values.
+func DefaultParseQueryOptions() *ParseQueryOptions {
+
+	opts := &ParseQueryOptions{
+		CaseSensitive: false,
+	}
+
+	return opts
+}
+
+// ParseQuery parses 'q' in to a `QueryNode` using the default options. The query syntax is:
+//
+//	foo bar		documents containing both "foo" and "bar" (the keyword "AND" may also be used)
+//	foo OR bar	documents containing either "foo" or "bar"
+//	-baz		documents which do not contain "baz" (the keyword "NOT" may also be used)
+//	(foo OR bar) baz	parentheses group expressions
+//	"new york"	documents containing the exact phrase "new york"
+//
+// AND binds more tightly than OR. Keywords must be upper case.
+func ParseQuery(q string) (QueryNode, error) {
+	opts := DefaultParseQueryOptions()
+	return ParseQueryWithOptions(q, opts)
+}
+
+// ParseQueryWithOptions parses 'q' in to a `QueryNode` using 'opts'. See `ParseQuery` for details.
+func ParseQueryWithOptions(q string, opts *ParseQueryOptions) (QueryNode, error) {
+
+	tokens, err := lexQuery(q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{
+		tokens: tokens,
+		opts:   opts,
+	}
+
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("Empty query")
+	}
+
+	node, err := p.parseOr()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.done() {
+		t := p.peek()
+		return nil, fmt.Errorf("Unexpected '%s' at position %d", t.value, t.pos)
+	}
+
+	return node, nil
+}
+
+const (
+	queryTokenTerm = iota
+	queryTokenPhrase
+	queryTokenOpen
+	queryTokenClose
+	queryTokenNot
+	queryTokenOr
+	queryTokenAnd
+)
+
+type queryToken struct {
+	kind  int
+	value string
+	// pos is the (1-based) position, in characters, of the start of the token in the query.
+	pos int
+}
+
+// lexQuery splits 'q' in to a list of `queryToken` instances.
+func lexQuery(q string) ([]*queryToken, error) {
+
+	tokens := make([]*queryToken, 0)
+
+	runes := []rune(q)
+
+	for i := 0; i < len(runes); {
+
+		r := runes[i]
+		pos := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, &queryToken{kind: queryTokenOpen, value: "(", pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, &queryToken{kind: queryTokenClose, value: ")", pos: pos})
+			i++
+		case r == '"':
+
+			start := i + 1
+			i = start
+
+			for i < len(runes) && runes[i] != '"' {
+				i++
+			}
+
+			if i >= len(runes) {
+				return nil, fmt.Errorf("Missing closing quote for phrase starting at position %d", pos)
+			}
+
+			phrase := strings.Join(strings.Fields(string(runes[start:i])), " ")
+			i++
+
+			if phrase == "" {
+				return nil, fmt.Errorf("Empty phrase at position %d", pos)
+			}
+
+			tokens = append(tokens, &queryToken{kind: queryTokenPhrase, value: phrase, pos: pos})
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != ')':
+			// a leading "-" negates the following term or group; a "-" inside a term (foo-bar) is part of the term
+			tokens = append(tokens, &queryToken{kind: queryTokenNot, value: "-", pos: pos})
+			i++
+		default:
+
+			start := i
+
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && runes[i] != '"' {
+				i++
+			}
+
+			value := string(runes[start:i])
+
+			switch value {
+			case "OR":
+				tokens = append(tokens, &queryToken{kind: queryTokenOr, value: value, pos: pos})
+			case "AND":
+				tokens = append(tokens, &queryToken{kind: queryTokenAnd, value: value, pos: pos})
+			case "NOT":
+				tokens = append(tokens, &queryToken{kind: queryTokenNot, value: value, pos: pos})
+			default:
+				tokens = append(tokens, &queryToken{kind: queryTokenTerm, value: value, pos: pos})
+			}
+		}
+	}
+
+	return tokens, nil
+}
+
+// queryParser implements a recursive descent parser for query tokens.
+type queryParser struct {
+	tokens []*queryToken
+	pos    int
+	opts   *ParseQueryOptions
+}
+
+func (p *queryParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *queryParser) peek() *queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() *queryToken {
+	t := p.tokens[p.pos]
+	p.pos += 1
+	return t
+}
+
+// parseOr parses: and ("OR" and)*
+func (p *queryParser) parseOr() (QueryNode, error) {
+
+	nodes := make([]QueryNode, 0)
+
+	for {
+
+		node, err := p.parseAnd()
+
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, node)
+
+		if p.done() || p.peek().kind != queryTokenOr {
+			break
+		}
+
+		p.next()
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+
+	return &OrNode{Nodes: nodes}, nil
+}
+
+// parseAnd parses: unary (["AND"] unary)*
+func (p *queryParser) parseAnd() (QueryNode, error) {
+
+	nodes := make([]QueryNode, 0)
+
+	for {
+
+		node, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, node)
+
+		if p.done() {
+			break
+		}
+
+		t := p.peek()
+
+		if t.kind == queryTokenAnd {
+			p.next()
+			continue
+		}
+
+		if t.kind == queryTokenOr || t.kind == queryTokenClose {
+			break
+		}
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+
+	return &AndNode{Nodes: nodes}, nil
+}
+
+// parseUnary parses: ("-" | "NOT") unary | primary
+func (p *queryParser) parseUnary() (QueryNode, error) {
+
+	if !p.done() && p.peek().kind == queryTokenNot {
+
+		p.next()
+
+		node, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &NotNode{Node: node}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+// parsePrimary parses: "(" or ")" | term
+func (p *queryParser) parsePrimary() (QueryNode, error) {
+
+	if p.done() {
+		return nil, fmt.Errorf("Unexpected end of query")
+	}
+
+	t := p.next()
+
+	switch t.kind {
+	case queryTokenTerm:
+		return &TermNode{Term: t.value}, nil
+	case queryTokenPhrase:
+		return &PhraseNode{Phrase: t.value, CaseSensitive: p.opts.CaseSensitive}, nil
+	case queryTokenOpen:
+
+		node, err := p.parseOr()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if p.done() || p.next().kind != queryTokenClose {
+			return nil, fmt.Errorf("Missing closing parenthesis for group starting at position %d", t.pos)
+		}
+
+		return node, nil
+	default:
+		return nil, fmt.Errorf("Unexpected '%s' at position %d", t.value, t.pos)
+	}
+}
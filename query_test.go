@@ -0,0 +1,205 @@
+package indexer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// describeQueryNode returns an unambiguous description of 'node' and its children.
+func describeQueryNode(node QueryNode) string {
+
+	describe := func(name string, nodes []QueryNode) string {
+
+		parts := make([]string, len(nodes))
+
+		for i, n := range nodes {
+			parts[i] = describeQueryNode(n)
+		}
+
+		return fmt.Sprintf("%s(%s)", name, strings.Join(parts, ", "))
+	}
+
+	switch n := node.(type) {
+	case *TermNode:
+		return n.Term
+	case *PhraseNode:
+
+		if n.CaseSensitive {
+			return fmt.Sprintf("%q/c", n.Phrase)
+		}
+
+		return fmt.Sprintf("%q", n.Phrase)
+
+	case *AndNode:
+		return describe("AND", n.Nodes)
+	case *OrNode:
+		return describe("OR", n.Nodes)
+	case *NotNode:
+		return describe("NOT", []QueryNode{n.Node})
+	default:
+		return fmt.Sprintf("%T", node)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		// terms and implicit or explicit AND
+		{`foo`, `foo`},
+		{`foo bar`, `AND(foo, bar)`},
+		{`foo AND bar`, `AND(foo, bar)`},
+		{`foo bar baz`, `AND(foo, bar, baz)`},
+		// keywords must be upper case
+		{`foo and bar or baz not`, `AND(foo, and, bar, or, baz, not)`},
+		// OR and precedence
+		{`foo OR bar`, `OR(foo, bar)`},
+		{`a OR b OR c`, `OR(a, b, c)`},
+		{`a b OR c`, `OR(AND(a, b), c)`},
+		{`a OR b c`, `OR(a, AND(b, c))`},
+		{`a AND b OR c AND d`, `OR(AND(a, b), AND(c, d))`},
+		// grouping
+		{`(a)`, `a`},
+		{`a (b OR c)`, `AND(a, OR(b, c))`},
+		{`(a OR b) (c OR d)`, `AND(OR(a, b), OR(c, d))`},
+		{`((a OR b) c) OR d`, `OR(AND(OR(a, b), c), d)`},
+		// negation
+		{`-foo`, `NOT(foo)`},
+		{`foo -bar`, `AND(foo, NOT(bar))`},
+		{`NOT foo bar`, `AND(NOT(foo), bar)`},
+		{`NOT NOT foo`, `NOT(NOT(foo))`},
+		{`-(a OR b) c`, `AND(NOT(OR(a, b)), c)`},
+		{`a OR -b`, `OR(a, NOT(b))`},
+		{`-"new york"`, `NOT("new york")`},
+		// a "-" which isn't followed by a term is a term, and a "-" inside a term is part of it
+		{`foo-bar`, `foo-bar`},
+		{`foo - bar`, `AND(foo, -, bar)`},
+		{`foo -`, `AND(foo, -)`},
+		// phrases
+		{`"new york"`, `"new york"`},
+		{`"  new   york  " city`, `AND("new york", city)`},
+		{`"new york" OR "san francisco"`, `OR("new york", "san francisco")`},
+		{`"a OR b"`, `"a OR b"`},
+		{`foo"bar"`, `AND(foo, "bar")`},
+		{`("new york")`, `"new york"`},
+	}
+
+	for _, test := range tests {
+
+		node, err := ParseQuery(test.query)
+
+		if err != nil {
+			t.Fatalf("Failed to parse '%s', %v", test.query, err)
+		}
+
+		actual := describeQueryNode(node)
+
+		if actual != test.expected {
+			t.Fatalf("Unexpected result parsing '%s': %s (expected %s)", test.query, actual, test.expected)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+
+	tests := []string{
+		``,
+		`   `,
+		`"foo`,
+		`foo "bar`,
+		`""`,
+		`"   "`,
+		`(foo`,
+		`(foo OR bar`,
+		`foo)`,
+		`()`,
+		`OR foo`,
+		`foo OR`,
+		`foo AND`,
+		`foo OR OR bar`,
+		`NOT`,
+		`foo -(`,
+	}
+
+	for _, q := range tests {
+
+		node, err := ParseQuery(q)
+
+		if err == nil {
+			t.Fatalf("Expected error parsing '%s', got %s", q, describeQueryNode(node))
+		}
+	}
+}
+
+func TestParseQueryErrorPositions(t *testing.T) {
+
+	// positions are the (1-based) offsets, in characters, of the start of the offending token in the query
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{`"foo`, `Missing closing quote for phrase starting at position 1`},
+		{`foo "bar`, `Missing closing quote for phrase starting at position 5`},
+		{`foo "  "`, `Empty phrase at position 5`},
+		{`foo)`, `Unexpected ')' at position 4`},
+		{`()`, `Unexpected ')' at position 2`},
+		{`OR foo`, `Unexpected 'OR' at position 1`},
+		{`foo OR OR bar`, `Unexpected 'OR' at position 8`},
+		{`"new york" ) city`, `Unexpected ')' at position 12`},
+		{`héllo wörld )`, `Unexpected ')' at position 13`},
+		{`a (b OR c`, `Missing closing parenthesis for group starting at position 3`},
+		{`foo AND`, `Unexpected end of query`},
+	}
+
+	for _, test := range tests {
+
+		_, err := ParseQuery(test.query)
+
+		if err == nil {
+			t.Fatalf("Expected error parsing '%s'", test.query)
+		}
+
+		if err.Error() != test.expected {
+			t.Fatalf("Unexpected error parsing '%s': %v (expected %s)", test.query, err, test.expected)
+		}
+	}
+}
+
+func TestParseQueryCaseSensitive(t *testing.T) {
+
+	opts := DefaultParseQueryOptions()
+	opts.CaseSensitive = true
+
+	node, err := ParseQueryWithOptions(`"New York" city`, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to parse query, %v", err)
+	}
+
+	actual := describeQueryNode(node)
+	expected := `AND("New York"/c, city)`
+
+	if actual != expected {
+		t.Fatalf("Unexpected result: %s (expected %s)", actual, expected)
+	}
+
+	phrase := node.(*AndNode).Nodes[0].(*PhraseNode)
+
+	if !phrase.Regexp().MatchString("in New \t York") || phrase.Regexp().MatchString("in New \n York") || phrase.Regexp().MatchString("in new york") {
+		t.Fatalf("Case-sensitive phrase regular expression does not match as expected")
+	}
+
+	node, err = ParseQuery(`"New York"`)
+
+	if err != nil {
+		t.Fatalf("Failed to parse query, %v", err)
+	}
+
+	if !node.(*PhraseNode).Regexp().MatchString("in new\tyork") {
+		t.Fatalf("Case-insensitive phrase regular expression does not match as expected")
+	}
+}
@@ -0,0 +1,250 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// SortById signals that results should be sorted by document id, which is the order in which documents were indexed.
+	SortById = "id"
+	// SortByScore signals that results should be sorted by score, highest first.
+	SortByScore = "score"
+)
+
+// BM25 parameters controlling term frequency saturation (k1) and document length normalization (b).
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// The weight given to the matching line density of a document, relative to one (idf weighted) term.
+const densityWeight = 0.5
+
+// The weight given to a term which matches the path of a document, relative to the idf of that term.
+const pathWeight = 1.0
+
+// resultScorer scores verified documents using a BM25-style function of the terms, phrases or regular expressions in a query.
+type resultScorer struct {
+	// idx is the index used to estimate the inverse document frequency of each matcher (see `prepare`).
+	idx *Index
+	// leaves are the matchers for each (positive) term, phrase or regular expression in the query.
+	leaves []*leafMatcher
+	// normalize is the function used to normalize text for matchers which match normalized text.
+	normalize func(string) string
+	// idf is the inverse document frequency of each matcher. It is nil until the scorer has been prepared.
+	idf []float64
+	// avgdl is the average size, in bytes, of the documents in the index.
+	avgdl float64
+}
+
+// newResultScorer returns a `resultScorer` for the (positive) matchers in 'm'.
+func (idx *Index) newResultScorer(m *queryMatcher) *resultScorer {
+
+	s := &resultScorer{
+		idx:       idx,
+		leaves:    m.positive,
+		normalize: m.normalize,
+	}
+
+	return s
+}
+
+// prepare estimates the number of documents matched by each matcher from the bloom filter, and the average document size,
+// unless it has already done so. Since this scans the bloom filter once per matcher it is deferred until the first document
+// is scored, rather than delaying the first result of a search, and it stops if 'ctx' is cancelled. If the index is renumbered
+// or replaced while the estimates are being made `ErrIndexChanged` is returned.
+func (s *resultScorer) prepare(ctx context.Context) error {
+
+	if s.idf != nil {
+		return nil
+	}
+
+	queries := make([]*bloomQuery, len(s.leaves))
+
+	for i, l := range s.leaves {
+
+		q, err := s.idx.compileQuery(l.node)
+
+		if err != nil {
+			return fmt.Errorf("Failed to compile query, %w", err)
+		}
+
+		queries[i] = q
+	}
+
+	return s.idx.scoreQueries(ctx, s, queries)
+}
+
+// scoreQueries assigns the inverse document frequencies of 'queries', the compiled (positive) matchers of 's', and the
+// average document size to 's'. If 'queries' were not compiled for the current generation of the index `ErrIndexChanged`
+// is returned.
+func (idx *Index) scoreQueries(ctx context.Context, s *resultScorer, queries []*bloomQuery) error {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	for _, q := range queries {
+
+		if q.generation != idx.generation {
+			return ErrIndexChanged
+		}
+	}
+
+	// documents added using Add don't have a file record so they are counted, since they are included in document
+	// frequencies, but their size is unknown
+
+	count := idx.currentDocumentCount - len(idx.tombstones)
+	files := 0
+	size := int64(0)
+
+	for id, f := range idx.idToFile {
+
+		if f == nil || idx.tombstones[uint32(id)] {
+			continue
+		}
+
+		files += 1
+		size += f.Size
+	}
+
+	idf := make([]float64, len(queries))
+
+	for i, q := range queries {
+
+		df, err := idx.estimateDocumentFrequency(ctx, q)
+
+		if err != nil {
+			return err
+		}
+
+		idf[i] = math.Log(1 + (float64(count)-float64(df)+0.5)/(float64(df)+0.5))
+	}
+
+	s.idf = idf
+	s.avgdl = 0
+
+	if files > 0 {
+		s.avgdl = float64(size) / float64(files)
+	}
+
+	return nil
+}
+
+// estimateDocumentFrequency returns the number of (live) documents which might match 'q' according to the bloom filter.
+// It assumes that the caller holds a read lock. If 'ctx' is cancelled the context's error is returned.
+func (idx *Index) estimateDocumentFrequency(ctx context.Context, q *bloomQuery) (int, error) {
+
+	count := idx.currentDocumentCount
+	df := 0
+
+	for i := 0; i < len(idx.bloomFilter); i += idx.bloomSize {
+
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+
+		first := DocumentsPerBlock * (i / idx.bloomSize)
+
+		if first >= count {
+			break
+		}
+
+		res := q.evaluate(idx.bloomFilter, i)
+
+		// mask documents which don't exist yet
+		if count-first < DocumentsPerBlock {
+			res = res & ((1 << uint(count-first)) - 1)
+		}
+
+		for j := 0; res != 0 && j < DocumentsPerBlock; j++ {
+
+			if res&(1<<j) != 0 && idx.tombstones[uint32(first+j)] {
+				res = res &^ (1 << j)
+			}
+		}
+
+		df += bits.OnesCount64(res)
+	}
+
+	return df, nil
+}
+
+// score returns the score for the document 'body', whose normalized equivalent is 'normalized' and whose path is 'path', in
+// which 'matching_lines' out of 'total_lines' lines matched. The score is the sum of the BM25 weights of each matcher, scaled
+// by the fraction of distinct matchers which matched, plus bonuses for the density of matching lines and for matchers which
+// match the path.
+func (s *resultScorer) score(body string, normalized string, path string, matching_lines int, total_lines int) float64 {
+
+	if len(s.leaves) == 0 {
+		return 0
+	}
+
+	normalized_path := s.normalize(path)
+
+	dl := float64(len(body))
+	avgdl := s.avgdl
+
+	if avgdl == 0 {
+		avgdl = dl
+	}
+
+	score := 0.0
+	distinct := 0
+
+	for i, l := range s.leaves {
+
+		tf := float64(len(l.re.FindAllStringIndex(l.text(body, normalized), -1)))
+
+		if tf > 0 {
+
+			distinct += 1
+
+			norm := 1.0
+
+			if avgdl > 0 {
+				norm = 1 - bm25B + bm25B*dl/avgdl
+			}
+
+			score += s.idf[i] * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+
+		if l.re.MatchString(l.text(path, normalized_path)) {
+			score += pathWeight * s.idf[i]
+		}
+	}
+
+	score = score * float64(distinct) / float64(len(s.leaves))
+
+	if total_lines > 0 {
+		score += densityWeight * float64(matching_lines) / float64(total_lines)
+	}
+
+	return score
+}
+
+// SortResults sorts 'results' in place using 'by' which is one of `SortById` or `SortByScore`.
+func SortResults(results []*Result, by string) {
+
+	switch by {
+	case SortByScore:
+
+		sort.SliceStable(results, func(i, j int) bool {
+
+			if results[i].Score == results[j].Score {
+				return results[i].Id < results[j].Id
+			}
+
+			return results[i].Score > results[j].Score
+		})
+
+	default:
+
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Id < results[j].Id
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestResultScorerMissingFileRecords(t *testing.T) {
+
+	ctx := context.Background()
+
+	idx, _ := newTestIndex(t, DefaultIndexOptions(), map[string]string{
+		"a.txt": "hello world",
+		"b.txt": "hello again",
+	})
+
+	// documents without a file record are ignored when scoring results
+	idx.idToFile[1] = nil
+
+	results, err := idx.Query(ctx, "hello", DefaultQueryOptions())
+
+	if err != nil {
+		t.Fatalf("Failed to query index, %v", err)
+	}
+
+	if len(results) != 1 || results[0].File.Path != "a.txt" {
+		t.Fatalf("Unexpected results: %v", results)
+	}
+}
+
+func TestResultScorerPrepare(t *testing.T) {
+
+	ctx := context.Background()
+
+	idx, _ := newTestIndex(t, DefaultIndexOptions(), map[string]string{
+		"a.txt": "hello world",
+		"b.txt": "goodbye world",
+	})
+
+	node, err := ParseQuery("hello world")
+
+	if err != nil {
+		t.Fatalf("Failed to parse query, %v", err)
+	}
+
+	m := newQueryMatcher(node, idx.Tokenizer().Normalize)
+	s := idx.newResultScorer(m)
+
+	// document frequencies are not estimated until the first document is scored
+
+	if s.idf != nil {
+		t.Fatalf("Unexpected document frequencies before scorer was prepared: %v", s.idf)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	err = s.prepare(cancelled)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	if s.idf != nil {
+		t.Fatalf("Unexpected document frequencies after scorer was cancelled: %v", s.idf)
+	}
+
+	err = s.prepare(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to prepare scorer, %v", err)
+	}
+
+	// "world" is in every document so it is weighted less than "hello"
+
+	if len(s.idf) != 2 || s.idf[0] <= s.idf[1] || s.avgdl != 12 {
+		t.Fatalf("Unexpected scorer: idf %v, avgdl %f", s.idf, s.avgdl)
+	}
+
+	// queries compiled before the index was renumbered are rejected
+
+	q, err := idx.compileQuery(m.positive[0].node)
+
+	if err != nil {
+		t.Fatalf("Failed to compile query, %v", err)
+	}
+
+	err = idx.Remove(0)
+
+	if err != nil {
+		t.Fatalf("Failed to remove document, %v", err)
+	}
+
+	err = idx.Compact()
+
+	if err != nil {
+		t.Fatalf("Failed to compact index, %v", err)
+	}
+
+	err = idx.scoreQueries(ctx, idx.newResultScorer(m), []*bloomQuery{q})
+
+	if !errors.Is(err, ErrIndexChanged) {
+		t.Fatalf("Expected ErrIndexChanged, got %v", err)
+	}
+}
+
+func TestSearchFuncCancelled(t *testing.T) {
+
+	idx, _ := newTestIndex(t, DefaultIndexOptions(), map[string]string{
+		"a.txt": "hello world",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cb := func(ctx context.Context, r *Result) error {
+		t.Fatalf("Unexpected result for cancelled search: %v", r)
+		return nil
+	}
+
+	err := idx.SearchFunc(ctx, "hello", DefaultQueryOptions(), cb)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+}
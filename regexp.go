@@ -0,0 +1,321 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// The maximum number of strings tracked for the set of exact strings a regular expression can match
+// before falling back to the trigram query for that set.
+const maxRegexpExactSet = 16
+
+// The maximum number of characters in a character class which will be expanded in to an exact set.
+const maxRegexpCharClass = 8
+
+// regexpInfo describes what is known about the strings matched by a (sub-)expression of a regular expression.
+type regexpInfo struct {
+	// exact is the set of all the (lower-cased) strings the expression can match, or nil if unknown.
+	exact []string
+	// match is a query that any document matching the expression must satisfy, or nil if nothing is known.
+	match QueryNode
+}
+
+// RegexpQuery derives a `QueryNode` from 're' which any document matching 're' must satisfy. The query will
+// only contain `TermNode`, `AndNode` and `OrNode` instances built from the literal strings that 're' requires,
+// in the spirit of Russ Cox's "Regular Expression Matching with a Trigram Index". If nothing can be derived
+// from 're' then a nil `QueryNode` is returned and every document should be considered a candidate.
+func RegexpQuery(re *regexp.Regexp) (QueryNode, error) {
+
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse regular expression, %w", err)
+	}
+
+	info := analyzeRegexp(parsed.Simplify())
+	return info.query(), nil
+}
+
+func analyzeRegexp(re *syntax.Regexp) *regexpInfo {
+
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return &regexpInfo{exact: []string{""}}
+
+	case syntax.OpLiteral:
+		return &regexpInfo{exact: []string{strings.ToLower(string(re.Rune))}}
+
+	case syntax.OpCharClass:
+
+		runes := make([]string, 0)
+		seen := make(map[rune]bool)
+
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+
+			lo := re.Rune[i]
+			hi := re.Rune[i+1]
+
+			if hi-lo >= maxRegexpCharClass {
+				return &regexpInfo{}
+			}
+
+			for r := lo; r <= hi; r++ {
+
+				low := unicode.ToLower(r)
+
+				if !seen[low] {
+					seen[low] = true
+					runes = append(runes, string(low))
+				}
+
+				if len(runes) > maxRegexpCharClass {
+					return &regexpInfo{}
+				}
+			}
+		}
+
+		return &regexpInfo{exact: runes}
+
+	case syntax.OpCapture:
+		return analyzeRegexp(re.Sub[0])
+
+	case syntax.OpQuest:
+
+		sub := analyzeRegexp(re.Sub[0])
+
+		if sub.exact != nil {
+			return &regexpInfo{exact: unionStrings(sub.exact, []string{""})}
+		}
+
+		return &regexpInfo{}
+
+	case syntax.OpPlus:
+		// x+ must match at least one x but we can no longer say exactly what it matches
+		sub := analyzeRegexp(re.Sub[0])
+		return &regexpInfo{match: sub.query()}
+
+	case syntax.OpRepeat:
+
+		if re.Min == 0 {
+			return &regexpInfo{}
+		}
+
+		sub := analyzeRegexp(re.Sub[0])
+		return &regexpInfo{match: sub.query()}
+
+	case syntax.OpConcat:
+
+		info := &regexpInfo{exact: []string{""}}
+
+		for _, sub := range re.Sub {
+			info = concatRegexpInfo(info, analyzeRegexp(sub))
+		}
+
+		return info
+
+	case syntax.OpAlternate:
+
+		info := analyzeRegexp(re.Sub[0])
+
+		for _, sub := range re.Sub[1:] {
+			info = alternateRegexpInfo(info, analyzeRegexp(sub))
+		}
+
+		return info
+
+	default:
+		// OpAnyChar, OpAnyCharNotNL, OpStar, OpNoMatch, etc.
+		return &regexpInfo{}
+	}
+}
+
+// concatRegexpInfo returns the `regexpInfo` for the concatenation of 'a' and 'b'.
+func concatRegexpInfo(a *regexpInfo, b *regexpInfo) *regexpInfo {
+
+	if a.exact != nil && b.exact != nil && len(a.exact)*len(b.exact) <= maxRegexpExactSet {
+
+		exact := make([]string, 0, len(a.exact)*len(b.exact))
+
+		for _, x := range a.exact {
+			for _, y := range b.exact {
+				exact = append(exact, x+y)
+			}
+		}
+
+		return &regexpInfo{exact: unionStrings(exact, nil)}
+	}
+
+	return &regexpInfo{match: andQueryNodes(a.query(), b.query())}
+}
+
+// alternateRegexpInfo returns the `regexpInfo` for the alternation of 'a' and 'b'.
+func alternateRegexpInfo(a *regexpInfo, b *regexpInfo) *regexpInfo {
+
+	if a.exact != nil && b.exact != nil {
+
+		exact := unionStrings(a.exact, b.exact)
+
+		if len(exact) <= maxRegexpExactSet {
+			return &regexpInfo{exact: exact}
+		}
+	}
+
+	return &regexpInfo{match: orQueryNodes(a.query(), b.query())}
+}
+
+// query returns a `QueryNode` which any document matching the expression described by 'info' must satisfy.
+func (info *regexpInfo) query() QueryNode {
+
+	if info.exact == nil {
+		return info.match
+	}
+
+	var q QueryNode
+
+	for i, s := range info.exact {
+
+		// the empty string (or anything else which isn't long enough to produce tokens) can match
+		// anywhere so nothing can be derived from this set; terms which are too short are otherwise
+		// handled when the query is compiled
+
+		if strings.TrimSpace(s) == "" {
+			return nil
+		}
+
+		t := &TermNode{Term: s}
+
+		if i == 0 {
+			q = t
+		} else {
+			q = orQueryNodes(q, t)
+		}
+	}
+
+	return q
+}
+
+// andQueryNodes returns a `QueryNode` matching both 'a' and 'b' where nil means "anything".
+func andQueryNodes(a QueryNode, b QueryNode) QueryNode {
+
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	}
+
+	nodes := make([]QueryNode, 0)
+
+	for _, n := range []QueryNode{a, b} {
+
+		if and, ok := n.(*AndNode); ok {
+			nodes = append(nodes, and.Nodes...)
+		} else {
+			nodes = append(nodes, n)
+		}
+	}
+
+	return &AndNode{Nodes: nodes}
+}
+
+// orQueryNodes returns a `QueryNode` matching either 'a' or 'b' where nil means "anything".
+func orQueryNodes(a QueryNode, b QueryNode) QueryNode {
+
+	if a == nil || b == nil {
+		return nil
+	}
+
+	nodes := make([]QueryNode, 0)
+
+	for _, n := range []QueryNode{a, b} {
+
+		if or, ok := n.(*OrNode); ok {
+			nodes = append(nodes, or.Nodes...)
+		} else {
+			nodes = append(nodes, n)
+		}
+	}
+
+	return &OrNode{Nodes: nodes}
+}
+
+// unionStrings returns the de-duplicated union of 'a' and 'b'.
+func unionStrings(a []string, b []string) []string {
+
+	seen := make(map[string]bool)
+	union := make([]string, 0, len(a)+len(b))
+
+	for _, list := range [][]string{a, b} {
+
+		for _, s := range list {
+
+			if !seen[s] {
+				seen[s] = true
+				union = append(union, s)
+			}
+		}
+	}
+
+	return union
+}
+
+// SearchRegexp returns the documents containing one or more lines matching 're'. Candidate documents are
+// determined by evaluating the query derived from 're' (see `RegexpQuery`) against the bloom filter and
+// then 're' is applied to each line of each candidate.
+func (idx *Index) SearchRegexp(ctx context.Context, re *regexp.Regexp) ([]*Result, error) {
+
+	q, err := RegexpQuery(re)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// tokenizers which remove or rewrite words don't index every substring of a document so the literal strings in
+	// a regular expression can't be used to pre-screen documents
+	if !indexesSubstrings(idx.Tokenizer()) {
+		q = nil
+	}
+
+	// a nil query means every document is a candidate
+	if q == nil {
+		q = &AndNode{Nodes: []QueryNode{}}
+	}
+
+	m := newRegexpMatcher(re, q, idx.Tokenizer().Normalize)
+
+	m.scorer = idx.newResultScorer(m)
+
+	results := make([]*Result, 0)
+
+	cb := func(ctx context.Context, r *Result) error {
+		results = append(results, r)
+		return nil
+	}
+
+	err = idx.searchFunc(ctx, q, m, DefaultQueryOptions(), cb)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// indexesSubstrings reports whether the tokens produced by 't' for a document include the tokens produced for every substring
+// of that document. This is not the case for tokenizers which remove stopwords or stem words. Since nothing is known about
+// the tokens produced by tokenizers other than the built-in trigram tokenizers they are assumed not to.
+func indexesSubstrings(t Tokenizer) bool {
+
+	tt, ok := t.(*trigramTokenizer)
+
+	if !ok {
+		return false
+	}
+
+	return len(tt.stopwords.words) == 0 && tt.stemmer.stem == nil
+}
@@ -0,0 +1,232 @@
+package indexer
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRegexpQuery(t *testing.T) {
+
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{`hello`, `hello`},
+		{`HELLO`, `hello`},
+		{`(?i)HeLLo`, `hello`},
+		{`hello|world`, `OR(hello, world)`},
+		{`(hello|gray) (world|dog)`, `OR(hello world, hello dog, gray world, gray dog)`},
+		{`gr[ae]y`, `OR(gray, grey)`},
+		{`gr[A-E]y`, `OR(gray, grby, grcy, grdy, grey)`},
+		{`colou?r`, `OR(colour, color)`},
+		{`hello.*world`, `AND(hello, world)`},
+		{`hello\s+world`, `AND(hello, world)`},
+		{`(abc)+`, `abc`},
+		{`foo\.bar`, `foo.bar`},
+		// nothing can be derived from these expressions
+		{`.*`, `<nil>`},
+		{`^$`, `<nil>`},
+		{``, `<nil>`},
+		{`a?`, `<nil>`},
+		{`[a-z]+`, `<nil>`},
+		{`x*`, `<nil>`},
+		{`(hello|.*)`, `<nil>`},
+		{`(hello)?world`, `OR(helloworld, world)`},
+	}
+
+	for _, test := range tests {
+
+		q, err := RegexpQuery(regexp.MustCompile(test.pattern))
+
+		if err != nil {
+			t.Fatalf("Failed to derive query for '%s', %v", test.pattern, err)
+		}
+
+		actual := "<nil>"
+
+		if q != nil {
+			actual = describeQueryNode(q)
+		}
+
+		if actual != test.expected {
+			t.Fatalf("Unexpected query for '%s': %s (expected %s)", test.pattern, actual, test.expected)
+		}
+	}
+}
+
+func TestSearchRegexp(t *testing.T) {
+
+	files := map[string]string{
+		"a.txt": "hello world\nthe grey cat",
+		"b.txt": "gray dog\nrunning fast",
+		"c.txt": "HELLO THERE\ncolour 555-1234",
+		"d.go":  "func main() {\n\treturn nil\n}",
+		"e.txt": "nothing to see here",
+		"f.txt": "foo.bar baz_qux camelCase",
+		"g.txt": "abcabcabc\n\ncolor",
+		"h.txt": "hello\nworld",
+	}
+
+	patterns := []string{
+		`hello`,
+		`HELLO`,
+		`(?i)hello`,
+		`(?i)HeLLo there`,
+		`hello|gray`,
+		`(hello|gray) (world|dog)`,
+		`gr[ae]y`,
+		`gr[a-z]y`,
+		`colou?r`,
+		`.*`,
+		`^$`,
+		`hello.*world`,
+		`[0-9]{3}-[0-9]{4}`,
+		`\bfunc\b`,
+		`(abc)+`,
+		`(abc){3}`,
+		`a?`,
+		`run+ing`,
+		`foo\.bar`,
+		`[[:upper:]]+`,
+		`cat$`,
+		`^\treturn`,
+		`baz_qux`,
+		`camel[A-Z]ase`,
+		`o\sw`,
+		`nothing|\d`,
+	}
+
+	tokenizers := []string{
+		"trigram://",
+		"trigram://?segmenter=unicode",
+		"trigram://?normalize=nfkc&fold=accents",
+		"trigram://?code=true",
+		"trigram://?stopwords=en&stem=en",
+		"merovius://",
+	}
+
+	ctx := context.Background()
+
+	for _, uri := range tokenizers {
+
+		tokenizer, err := NewTokenizer(ctx, uri)
+
+		if err != nil {
+			t.Fatalf("Failed to create tokenizer for %s, %v", uri, err)
+		}
+
+		opts := DefaultIndexOptions()
+		opts.Tokenizer = tokenizer
+
+		idx, _ := newTestIndex(t, opts, files)
+
+		for _, pattern := range patterns {
+
+			re := regexp.MustCompile(pattern)
+
+			expected := make([]uint32, 0)
+
+			for id := uint32(0); int(id) < len(files); id++ {
+
+				f := idx.IdToFile(id)
+
+				for _, l := range strings.Split(files[f.Path], "\n") {
+
+					if re.MatchString(l) {
+						expected = append(expected, id)
+						break
+					}
+				}
+			}
+
+			// every document which matches must be a candidate, in other words there are no false negatives
+
+			q, err := RegexpQuery(re)
+
+			if err != nil {
+				t.Fatalf("Failed to derive query for '%s', %v", pattern, err)
+			}
+
+			if q != nil && indexesSubstrings(tokenizer) {
+
+				candidates, err := idx.SearchQuery(q)
+
+				if err != nil {
+					t.Fatalf("Failed to search query for '%s', %v", pattern, err)
+				}
+
+				for _, id := range expected {
+
+					if !slices.Contains(candidates, id) {
+						t.Fatalf("Document %s matches '%s' but is not a candidate for %s using %s", idx.IdToFile(id).Path, pattern, describeQueryNode(q), uri)
+					}
+				}
+			}
+
+			results, err := idx.SearchRegexp(ctx, re)
+
+			if err != nil {
+				t.Fatalf("Failed to search '%s', %v", pattern, err)
+			}
+
+			actual := make([]uint32, len(results))
+
+			for i, r := range results {
+				actual[i] = r.Id
+			}
+
+			if !slices.Equal(actual, expected) {
+				t.Fatalf("Unexpected results for '%s' using %s: %v (expected %v)", pattern, uri, actual, expected)
+			}
+		}
+	}
+}
+
+// wordTokenizer is a `Tokenizer` whose tokens are the (lower-cased) words in a text, so it doesn't index substrings.
+type wordTokenizer struct{}
+
+func (t *wordTokenizer) Tokenize(text string) []string {
+	return strings.Fields(t.Normalize(text))
+}
+
+func (t *wordTokenizer) Normalize(text string) string {
+	return strings.ToLower(text)
+}
+
+func (t *wordTokenizer) URI() string {
+	return "word://"
+}
+
+func TestSearchRegexpCustomTokenizer(t *testing.T) {
+
+	ctx := context.Background()
+
+	tokenizer := &wordTokenizer{}
+
+	if indexesSubstrings(tokenizer) {
+		t.Fatalf("Tokenizers other than the built-in tokenizers should not be assumed to index substrings")
+	}
+
+	opts := DefaultIndexOptions()
+	opts.Tokenizer = tokenizer
+
+	idx, _ := newTestIndex(t, opts, map[string]string{
+		"a.txt": "hello world",
+		"b.txt": "goodbye world",
+	})
+
+	// "ell" is not a token so the bloom filter can't be used to find candidates for the regular expression
+
+	results, err := idx.SearchRegexp(ctx, regexp.MustCompile(`ell`))
+
+	if err != nil {
+		t.Fatalf("Failed to search regular expression, %v", err)
+	}
+
+	if len(results) != 1 || results[0].File.Path != "a.txt" {
+		t.Fatalf("Unexpected results: %v", results)
+	}
+}
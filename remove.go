@@ -0,0 +1,134 @@
+package indexer
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Remove marks the document 'id' as deleted (tombstones it) so that it will no longer be returned by `Search`. The
+// bloom filter data for the document is not removed until `Compact` is called.
+func (idx *Index) Remove(id uint32) error {
+
+	idx.writerMu.Lock()
+	defer idx.writerMu.Unlock()
+
+	return idx.remove(id)
+}
+
+// remove implements the `Remove` method. It assumes the caller has acquired the writer lock.
+func (idx *Index) remove(id uint32) error {
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if int(id) >= idx.currentDocumentCount {
+		return fmt.Errorf("Invalid document id %d", id)
+	}
+
+	idx.tombstones[id] = true
+	return nil
+}
+
+// RemoveFile marks the document for 'path' in the bucket 'bucket_uri' as deleted. It is not considered an error if
+// there is no such document in the index.
+func (idx *Index) RemoveFile(bucket_uri string, path string) error {
+
+	idx.writerMu.Lock()
+	defer idx.writerMu.Unlock()
+
+	bucket_id, exists := idx.bucketURIs[bucket_uri]
+
+	if !exists {
+		return fmt.Errorf("Unknown bucket URI '%s'", bucket_uri)
+	}
+
+	for id, f := range idx.idToFile {
+
+		if f.BucketId == bucket_id && f.Path == path {
+
+			err := idx.remove(uint32(id))
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// IsRemoved reports whether the document 'id' has been marked as deleted.
+func (idx *Index) IsRemoved(id uint32) bool {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.tombstones[id]
+}
+
+// Tombstones returns the sorted list of document ids that have been marked as deleted.
+func (idx *Index) Tombstones() []uint32 {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.tombstoneIds()
+}
+
+// tombstoneIds implements the `Tombstones` method. It assumes the caller has acquired a lock on the index.
+func (idx *Index) tombstoneIds() []uint32 {
+
+	ids := make([]uint32, 0, len(idx.tombstones))
+
+	for id := range idx.tombstones {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	return ids
+}
+
+// Compact rebuilds the index without the bloom filter data for documents which have been marked as deleted. The
+// remaining documents are renumbered so any document ids obtained before calling `Compact` should be considered invalid.
+func (idx *Index) Compact() error {
+
+	idx.writerMu.Lock()
+	defer idx.writerMu.Unlock()
+
+	if len(idx.tombstones) == 0 {
+		return nil
+	}
+
+	compacted := idx.emptyCopy()
+
+	for id := 0; id < idx.currentDocumentCount; id++ {
+
+		if idx.tombstones[uint32(id)] {
+			continue
+		}
+
+		// documents added using Add don't have a file record
+		var f *File
+
+		if id < len(idx.idToFile) {
+			f = idx.idToFile[id]
+		}
+
+		doc := &indexedDocument{
+			item: idx.documentBits(uint32(id)),
+			file: f,
+		}
+
+		err := compacted.addDocument(doc)
+
+		if err != nil {
+			return fmt.Errorf("Failed to copy document %d, %w", id, err)
+		}
+	}
+
+	idx.swap(compacted)
+	return nil
+}
@@ -0,0 +1,202 @@
+package indexer
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestRemove(t *testing.T) {
+
+	idx, _ := newTestIndex(t, DefaultIndexOptions(), map[string]string{
+		"a.txt": "hello world",
+		"b.txt": "hello again",
+		"c.txt": "goodbye world",
+	})
+
+	err := idx.Remove(1)
+
+	if err != nil {
+		t.Fatalf("Failed to remove document, %v", err)
+	}
+
+	// removing a document twice is not an error
+
+	err = idx.Remove(1)
+
+	if err != nil {
+		t.Fatalf("Failed to remove document again, %v", err)
+	}
+
+	err = idx.Remove(3)
+
+	if err == nil {
+		t.Fatalf("Expected error removing document which does not exist")
+	}
+
+	if !idx.IsRemoved(1) || idx.IsRemoved(0) || !slices.Equal(idx.Tombstones(), []uint32{1}) {
+		t.Fatalf("Unexpected tombstones: %v", idx.Tombstones())
+	}
+
+	ids := idx.Search(idx.Queryise("hello"))
+
+	if !slices.Equal(ids, []uint32{0}) {
+		t.Fatalf("Unexpected results for Search after removing document: %v", ids)
+	}
+
+	paths := queryPaths(t, idx, "hello")
+
+	if !slices.Equal(paths, []string{"a.txt"}) {
+		t.Fatalf("Unexpected results for Query after removing document: %v", paths)
+	}
+
+	if idx.Statistics().Documents != 2 {
+		t.Fatalf("Unexpected number of documents: %d", idx.Statistics().Documents)
+	}
+}
+
+func TestRemoveFile(t *testing.T) {
+
+	idx, uri := newTestIndex(t, DefaultIndexOptions(), map[string]string{
+		"a.txt":     "hello world",
+		"sub/a.txt": "hello again",
+	})
+
+	err := idx.RemoveFile("file:///unknown", "a.txt")
+
+	if err == nil {
+		t.Fatalf("Expected error removing file from unknown bucket")
+	}
+
+	// files which aren't in the index are ignored
+
+	err = idx.RemoveFile(uri, "missing.txt")
+
+	if err != nil {
+		t.Fatalf("Failed to remove missing file, %v", err)
+	}
+
+	if len(idx.Tombstones()) != 0 {
+		t.Fatalf("Unexpected tombstones after removing missing file: %v", idx.Tombstones())
+	}
+
+	err = idx.RemoveFile(uri, "sub/a.txt")
+
+	if err != nil {
+		t.Fatalf("Failed to remove file, %v", err)
+	}
+
+	paths := queryPaths(t, idx, "hello")
+
+	if !slices.Equal(paths, []string{"a.txt"}) {
+		t.Fatalf("Unexpected results after removing file: %v", paths)
+	}
+}
+
+func TestCompact(t *testing.T) {
+
+	// enough documents to span several blocks
+
+	files := make(map[string]string)
+
+	for i := 0; i < 3*DocumentsPerBlock; i++ {
+
+		body := fmt.Sprintf("document %03d", i)
+
+		if i%2 == 0 {
+			body += " even"
+		}
+
+		if i%5 == 0 {
+			body += " fives"
+		}
+
+		files[fmt.Sprintf("%03d.txt", i)] = body
+	}
+
+	idx, _ := newTestIndex(t, DefaultIndexOptions(), files)
+
+	// compacting an index without any tombstones does nothing
+
+	err := idx.Compact()
+
+	if err != nil {
+		t.Fatalf("Failed to compact index, %v", err)
+	}
+
+	if idx.Statistics().Documents != len(files) {
+		t.Fatalf("Unexpected number of documents: %d", idx.Statistics().Documents)
+	}
+
+	removed := []uint32{0, 3, 63, 64, 65, 100, 191}
+
+	for _, id := range removed {
+
+		err := idx.Remove(id)
+
+		if err != nil {
+			t.Fatalf("Failed to remove document %d, %v", id, err)
+		}
+	}
+
+	queries := []string{"document", "even", "fives", "even fives", "fives -even", `"document 064"`, `"document 066"`}
+	expected := make(map[string][]string)
+
+	for _, q := range queries {
+		expected[q] = queryPaths(t, idx, q)
+	}
+
+	err = idx.Compact()
+
+	if err != nil {
+		t.Fatalf("Failed to compact index, %v", err)
+	}
+
+	if len(idx.Tombstones()) != 0 {
+		t.Fatalf("Unexpected tombstones after compacting index: %v", idx.Tombstones())
+	}
+
+	count := len(files) - len(removed)
+
+	if idx.Statistics().Documents != count {
+		t.Fatalf("Unexpected number of documents after compacting index: %d", idx.Statistics().Documents)
+	}
+
+	// the remaining documents are renumbered, in their original order, without any gaps
+
+	id := uint32(0)
+
+	for i := 0; i < len(files); i++ {
+
+		if slices.Contains(removed, uint32(i)) {
+			continue
+		}
+
+		f := idx.IdToFile(id)
+
+		if f == nil || f.Path != fmt.Sprintf("%03d.txt", i) {
+			t.Fatalf("Unexpected file for document %d after compacting index: %v", id, f)
+		}
+
+		id += 1
+	}
+
+	if idx.IdToFile(id) != nil {
+		t.Fatalf("Unexpected file for document %d after compacting index", id)
+	}
+
+	for _, q := range queries {
+
+		paths := queryPaths(t, idx, q)
+
+		if !slices.Equal(paths, expected[q]) {
+			t.Fatalf("Unexpected results for '%s' after compacting index: %v (expected %v)", q, paths, expected[q])
+		}
+	}
+
+	ids := idx.Search(idx.Queryise("document"))
+
+	if len(ids) != count || ids[len(ids)-1] != uint32(count-1) {
+		t.Fatalf("Unexpected results for Search after compacting index: %v", ids)
+	}
+}
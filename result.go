@@ -0,0 +1,211 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Result is a document which has been verified to match a search.
+type Result struct {
+	// Id is the document's id in the index.
+	Id uint32 `json:"id"`
+	// File is the file associated with the document.
+	File *File `json:"file"`
+	// BucketURI is the URI of the bucket containing the file.
+	BucketURI string `json:"bucket_uri"`
+	// Matches are the lines in the document which matched the search.
+	Matches []*Match `json:"matches"`
+	// Score is the relevance of the document to the search. Higher scores are more relevant.
+	Score float64 `json:"score"`
+}
+
+// Match is a line in a document which matched a search.
+type Match struct {
+	// Line is the (1-based) line number of the match.
+	Line int `json:"line"`
+	// Column is the (1-based) position, in characters, of the first match in the line.
+	Column int `json:"column"`
+	// ByteOffset is the (0-based) position, in bytes, of the first match in the line relative to the start of the document.
+	ByteOffset int64 `json:"byte_offset"`
+	// Text is the text of the line.
+	Text string `json:"text"`
+}
+
+func (m *Match) String() string {
+	return fmt.Sprintf("%v. %v", m.Line, m.Text)
+}
+
+// QueryOptions defines configuration options for the `Query` and `SearchFunc` methods.
+type QueryOptions struct {
+	// MaxResults is the maximum number of results to return. If 0 all the results are returned.
+	MaxResults int
+	// MaxMatches is the maximum number of matches to return for each result. If 0 all the matches are returned.
+	MaxMatches int
+	// CaseSensitive signals that quoted phrases should be matched case-sensitively.
+	CaseSensitive bool
+	// Sort is the order in which results are returned by `Query`, either `SortById` or `SortByScore`. Results
+	// yielded by `SearchFunc` are always in document id order.
+	Sort string
+}
+
+// DefaultQueryOptions returns a `QueryOptions` instance with default values.
+func DefaultQueryOptions() *QueryOptions {
+
+	opts := &QueryOptions{
+		MaxResults:    0,
+		MaxMatches:    0,
+		CaseSensitive: false,
+		Sort:          SortById,
+	}
+
+	return opts
+}
+
+// Query parses 'q' (see `ParseQuery` for details) and returns the documents which match it. Candidate documents are
+// determined using the bloom filter and then verified against their content so, unlike `Search` or `SearchQuery`, the
+// results do not contain any false positives. Each result contains the lines in the document which contain a term or
+// phrase from the query that is not negated. Results are ordered according to 'opts.Sort' (see `SortResults`).
+func (idx *Index) Query(ctx context.Context, q string, opts *QueryOptions) ([]*Result, error) {
+
+	search_opts := *opts
+
+	switch opts.Sort {
+	case SortById, "":
+		// pass
+	case SortByScore:
+		// every result needs to be scored before the best ones can be selected
+		search_opts.MaxResults = 0
+	default:
+		return nil, fmt.Errorf("Unsupported sort order '%s'", opts.Sort)
+	}
+
+	results := make([]*Result, 0)
+
+	cb := func(ctx context.Context, r *Result) error {
+		results = append(results, r)
+		return nil
+	}
+
+	err := idx.SearchFunc(ctx, q, &search_opts, cb)
+
+	if err != nil {
+		return nil, err
+	}
+
+	SortResults(results, opts.Sort)
+
+	if opts.MaxResults > 0 && len(results) > opts.MaxResults {
+		results = results[:opts.MaxResults]
+	}
+
+	return results, nil
+}
+
+// verifyDocument reads the document 'id' and returns a `Result` containing (up to 'max_matches') lines matched by 'm'. If 'm' has
+// a query the document must satisfy it, otherwise the document must contain at least one matching line. If the document does
+// not match (or no longer exists) then nil is returned.
+func (idx *Index) verifyDocument(ctx context.Context, id uint32, m *queryMatcher, max_matches int) (*Result, error) {
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	f := idx.IdToFile(id)
+
+	// the index may have been renumbered (by Update or Compact) since the search was performed
+	if f == nil {
+		return nil, nil
+	}
+
+	r, err := idx.OpenFile(ctx, id)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open document %d, %w", id, err)
+	}
+
+	defer r.Close()
+
+	res, err := io.ReadAll(&contextReader{ctx: ctx, r: r})
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read document %d, %w", id, err)
+	}
+
+	body := string(res)
+	normalized := m.normalize(body)
+
+	if !m.matchesDocument(body, normalized) {
+		return nil, nil
+	}
+
+	matches := make([]*Match, 0)
+	matching_lines := 0
+	offset := 0
+
+	lines := strings.Split(body, "\n")
+
+	for i, l := range lines {
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		line_offset := offset
+		offset += len(l) + 1
+
+		l = strings.TrimSuffix(l, "\r")
+		pos := m.matchLine(l)
+
+		if pos == -1 {
+			continue
+		}
+
+		matching_lines += 1
+
+		if max_matches > 0 && len(matches) >= max_matches {
+
+			// keep counting matching lines for scoring
+			if m.scorer != nil {
+				continue
+			}
+
+			break
+		}
+
+		match := &Match{
+			Line:       i + 1,
+			Column:     utf8.RuneCountInString(l[:pos]) + 1,
+			ByteOffset: int64(line_offset + pos),
+			Text:       l,
+		}
+
+		matches = append(matches, match)
+	}
+
+	if m.node == nil && len(matches) == 0 {
+		return nil, nil
+	}
+
+	result := &Result{
+		Id:        id,
+		File:      f,
+		BucketURI: idx.bucketURI(f.BucketId),
+		Matches:   matches,
+	}
+
+	if m.scorer != nil {
+
+		err := m.scorer.prepare(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to derive scorer, %w", err)
+		}
+
+		result.Score = m.scorer.score(body, normalized, f.Path, matching_lines, len(lines))
+	}
+
+	return result, nil
+}
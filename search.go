@@ -0,0 +1,252 @@
+package indexer
+
+import (
+	"fmt"
+)
+
+const (
+	bloomQueryTerm = iota
+	bloomQueryAnd
+	bloomQueryOr
+	bloomQueryAll
+)
+
+// maxCompileAttempts is the number of times `SearchQuery` will compile a query before giving up because the index keeps
+// being renumbered or replaced.
+const maxCompileAttempts = 3
+
+// bloomQuery is a `QueryNode` compiled in to the bloom filter positions needed to evaluate it
+// against the blocks of an index.
+type bloomQuery struct {
+	op       int
+	bits     []uint64
+	children []*bloomQuery
+	// generation is the generation of the index (see `Index.generation`) the query was compiled for. It is only set
+	// for the root of a query.
+	generation uint64
+}
+
+// compileQuery compiles 'node' in to a `bloomQuery` using the index's tokenizer, bloom filter parameters and term
+// table. Since these may be replaced (by `ImportArchive`), or the documents renumbered, once the query has been compiled
+// callers must check that the query's generation matches the index's generation, while holding the read lock used to
+// evaluate it, and compile the query again (or fail) if it doesn't.
+func (idx *Index) compileQuery(node QueryNode) (*bloomQuery, error) {
+
+	idx.mu.RLock()
+	generation := idx.generation
+	idx.mu.RUnlock()
+
+	q, err := idx.compileNode(node)
+
+	if err != nil {
+		return nil, err
+	}
+
+	q.generation = generation
+	return q, nil
+}
+
+// compileNode compiles 'node', and its children, in to a `bloomQuery` (see `compileQuery`).
+func (idx *Index) compileNode(node QueryNode) (*bloomQuery, error) {
+
+	switch n := node.(type) {
+	case *TermNode:
+
+		bits := idx.Queryise(n.Term)
+
+		// terms which don't produce any tokens (for example because they are too short)
+		// can't be used to rule out documents
+
+		if len(bits) == 0 {
+			return &bloomQuery{op: bloomQueryAll}, nil
+		}
+
+		return &bloomQuery{op: bloomQueryTerm, bits: bits}, nil
+
+	case *PhraseNode:
+
+		bits := idx.QueryisePhrase(n.Phrase)
+
+		if len(bits) == 0 {
+			return &bloomQuery{op: bloomQueryAll}, nil
+		}
+
+		return &bloomQuery{op: bloomQueryTerm, bits: bits}, nil
+
+	case *AndNode, *OrNode:
+
+		var nodes []QueryNode
+		op := bloomQueryAnd
+
+		switch n := node.(type) {
+		case *AndNode:
+			nodes = n.Nodes
+		case *OrNode:
+			nodes = n.Nodes
+			op = bloomQueryOr
+		}
+
+		q := &bloomQuery{
+			op:       op,
+			children: make([]*bloomQuery, 0, len(nodes)),
+		}
+
+		for _, child := range nodes {
+
+			child_q, err := idx.compileNode(child)
+
+			if err != nil {
+				return nil, err
+			}
+
+			// the bloom filter can't rule out any documents for an OR containing an
+			// unrestricted expression and an AND can ignore them entirely
+
+			if child_q.op == bloomQueryAll {
+
+				if op == bloomQueryOr {
+					return child_q, nil
+				}
+
+				continue
+			}
+
+			q.children = append(q.children, child_q)
+		}
+
+		if len(q.children) == 0 {
+			return &bloomQuery{op: bloomQueryAll}, nil
+		}
+
+		return q, nil
+
+	case *NotNode:
+		// negation is applied when documents are verified
+		return &bloomQuery{op: bloomQueryAll}, nil
+
+	default:
+		return nil, fmt.Errorf("Unsupported query node %T", node)
+	}
+}
+
+// evaluate returns a mask whose set bits indicate the documents in the block starting at 'offset'
+// which might match the query.
+func (q *bloomQuery) evaluate(bloom_filter []uint64, offset int) uint64 {
+
+	switch q.op {
+	case bloomQueryTerm:
+
+		res := bloom_filter[q.bits[0]+uint64(offset)]
+
+		for j := 1; j < len(q.bits) && res != 0; j++ {
+			res = res & bloom_filter[q.bits[j]+uint64(offset)]
+		}
+
+		return res
+
+	case bloomQueryAnd:
+
+		res := ^uint64(0)
+
+		for _, child := range q.children {
+
+			res = res & child.evaluate(bloom_filter, offset)
+
+			if res == 0 {
+				break
+			}
+		}
+
+		return res
+
+	case bloomQueryOr:
+
+		res := uint64(0)
+
+		for _, child := range q.children {
+			res = res | child.evaluate(bloom_filter, offset)
+		}
+
+		return res
+
+	default:
+		return ^uint64(0)
+	}
+}
+
+// SearchQuery returns the ids of the documents which might match 'node'. Like `Search` the results may contain
+// false positives, and will not account for negated expressions, so documents should be verified against their
+// content (for example using `DocumentMatchesQuery`). Terms and phrases are expanded using the index's synonyms so
+// documents should be verified against the expanded query (see `ExpandSynonyms`). If the index is renumbered or replaced
+// every time the query is compiled `ErrIndexChanged` is returned.
+func (idx *Index) SearchQuery(node QueryNode) ([]uint32, error) {
+
+	node = idx.ExpandSynonyms(node)
+
+	for i := 0; i < maxCompileAttempts; i++ {
+
+		q, err := idx.compileQuery(node)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to compile query, %w", err)
+		}
+
+		results, ok := idx.searchQuery(q)
+
+		// the index was renumbered or replaced while the query was being compiled so compile it again
+		if !ok {
+			continue
+		}
+
+		return results, nil
+	}
+
+	return nil, ErrIndexChanged
+}
+
+// searchQuery returns the ids of the documents which might match 'q' and a boolean value indicating whether 'q' was
+// compiled for the current generation of the index. If it wasn't no ids are returned.
+func (idx *Index) searchQuery(q *bloomQuery) ([]uint32, bool) {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if q.generation != idx.generation {
+		return nil, false
+	}
+
+	results := make([]uint32, 0)
+	count := idx.currentDocumentCount
+
+	for i := 0; i < len(idx.bloomFilter); i += idx.bloomSize {
+
+		res := q.evaluate(idx.bloomFilter, i)
+
+		if res == 0 {
+			continue
+		}
+
+		for j := 0; j < DocumentsPerBlock; j++ {
+
+			if res&(1<<j) == 0 {
+				continue
+			}
+
+			id := uint32(DocumentsPerBlock*(i/idx.bloomSize) + j)
+
+			// unrestricted expressions will set bits for documents which don't exist yet
+			if int(id) >= count {
+				break
+			}
+
+			// skip documents which have been removed
+			if idx.tombstones[id] {
+				continue
+			}
+
+			results = append(results, id)
+		}
+	}
+
+	return results, true
+}
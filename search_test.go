@@ -0,0 +1,221 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// newTestArchive returns an archive, exported from an index of 'files' created using 'opts'.
+func newTestArchive(t *testing.T, opts *IndexOptions, files map[string]string) *bytes.Buffer {
+
+	t.Helper()
+
+	idx, _ := newTestIndex(t, opts, files)
+
+	var buf bytes.Buffer
+
+	err := idx.ExportArchive(context.Background(), &buf)
+
+	if err != nil {
+		t.Fatalf("Failed to export archive, %v", err)
+	}
+
+	return &buf
+}
+
+func TestSearchBitsOutsideBloomFilter(t *testing.T) {
+
+	opts := DefaultIndexOptions()
+	opts.BloomSize = 64
+
+	idx, _ := newTestIndex(t, opts, map[string]string{
+		"a.txt": "hello world",
+	})
+
+	// the package-level hash functions use the default bloom filter size
+	bits := HashBloom([]byte("hel"))
+	bits = append(bits, uint64(BloomSize-1))
+
+	ids := idx.Search(bits)
+
+	if len(ids) != 0 {
+		t.Fatalf("Unexpected results for bits outside the bloom filter: %v", ids)
+	}
+
+	ids = idx.Search(idx.Queryise("hello"))
+
+	if !slices.Equal(ids, []uint32{0}) {
+		t.Fatalf("Unexpected results: %v", ids)
+	}
+}
+
+func TestSearchQueryAfterImport(t *testing.T) {
+
+	ctx := context.Background()
+
+	files := map[string]string{
+		"a.txt": "hello world",
+		"b.txt": "goodbye world",
+	}
+
+	idx, _ := newTestIndex(t, DefaultIndexOptions(), files)
+
+	// an archive with a smaller bloom filter, and more documents, than the index
+
+	small_opts := DefaultIndexOptions()
+	small_opts.BloomSize = 192
+
+	small_files := map[string]string{
+		"c.txt": "nothing here",
+		"d.txt": "hello again",
+		"e.txt": "goodbye again",
+	}
+
+	archive := newTestArchive(t, small_opts, small_files)
+
+	node, err := ParseQuery("goodbye")
+
+	if err != nil {
+		t.Fatalf("Failed to parse query, %v", err)
+	}
+
+	q, err := idx.compileQuery(node)
+
+	if err != nil {
+		t.Fatalf("Failed to compile query, %v", err)
+	}
+
+	err = idx.ImportArchive(ctx, archive)
+
+	if err != nil {
+		t.Fatalf("Failed to import archive, %v", err)
+	}
+
+	// queries compiled for the index before it was replaced are rejected instead of being evaluated
+
+	_, ok := idx.searchQuery(q)
+
+	if ok {
+		t.Fatalf("Expected query compiled before the import to be rejected")
+	}
+
+	_, _, err = idx.blockCandidates(q, 0)
+
+	if !errors.Is(err, ErrIndexChanged) {
+		t.Fatalf("Expected ErrIndexChanged, got %v", err)
+	}
+
+	ids, err := idx.SearchQuery(node)
+
+	if err != nil {
+		t.Fatalf("Failed to search query, %v", err)
+	}
+
+	if !slices.Equal(ids, []uint32{2}) {
+		t.Fatalf("Unexpected results after import: %v", ids)
+	}
+
+	results, err := idx.Query(ctx, "goodbye", DefaultQueryOptions())
+
+	if err != nil {
+		t.Fatalf("Failed to query index, %v", err)
+	}
+
+	if len(results) != 1 || results[0].File.Path != "e.txt" {
+		t.Fatalf("Unexpected results for query after import: %v", results)
+	}
+}
+
+func TestSearchFuncImportDuringSearch(t *testing.T) {
+
+	ctx := context.Background()
+
+	idx, _ := newTestIndex(t, DefaultIndexOptions(), map[string]string{
+		"a.txt": "hello world",
+		"b.txt": "hello again",
+	})
+
+	archive := newTestArchive(t, DefaultIndexOptions(), map[string]string{
+		"c.txt": "goodbye world",
+		"d.txt": "hello there",
+	})
+
+	count := 0
+
+	cb := func(ctx context.Context, r *Result) error {
+
+		count += 1
+
+		if count == 1 {
+			return idx.ImportArchive(ctx, archive)
+		}
+
+		return nil
+	}
+
+	err := idx.SearchFunc(ctx, "hello", DefaultQueryOptions(), cb)
+
+	if !errors.Is(err, ErrIndexChanged) {
+		t.Fatalf("Expected ErrIndexChanged, got %v", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("Unexpected number of results yielded after import: %d", count)
+	}
+}
+
+func TestSearchFuncCompactDuringSearch(t *testing.T) {
+
+	ctx := context.Background()
+
+	idx, _ := newTestIndex(t, DefaultIndexOptions(), map[string]string{
+		"a.txt": "hello world",
+		"b.txt": "goodbye world",
+		"c.txt": "hello again",
+	})
+
+	count := 0
+
+	cb := func(ctx context.Context, r *Result) error {
+
+		count += 1
+
+		if count > 1 {
+			return nil
+		}
+
+		// renumber the documents so that "c.txt" becomes document 1
+		err := idx.Remove(1)
+
+		if err != nil {
+			return err
+		}
+
+		return idx.Compact()
+	}
+
+	err := idx.SearchFunc(ctx, "hello", DefaultQueryOptions(), cb)
+
+	if !errors.Is(err, ErrIndexChanged) {
+		t.Fatalf("Expected ErrIndexChanged, got %v", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("Unexpected number of results yielded after compacting index: %d", count)
+	}
+
+	// searches which start after the index has been renumbered are not affected
+
+	results, err := idx.Query(ctx, "hello", DefaultQueryOptions())
+
+	if err != nil {
+		t.Fatalf("Failed to query index, %v", err)
+	}
+
+	if len(results) != 2 || results[1].Id != 1 || results[1].File.Path != "c.txt" {
+		t.Fatalf("Unexpected results after compacting index: %v", results)
+	}
+}
@@ -0,0 +1,205 @@
+package indexer
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	// SegmenterWhitespace signals that words are separated by whitespace.
+	SegmenterWhitespace = "whitespace"
+	// SegmenterUnicode signals that words are runs of (Unicode) letters, digits and marks.
+	SegmenterUnicode = "unicode"
+)
+
+// wordSegmenter determines which characters separate words.
+type wordSegmenter struct {
+	// mode is one of `SegmenterWhitespace` or `SegmenterUnicode`.
+	mode string
+	// separators are additional characters which separate words.
+	separators string
+	// keep are additional characters which are considered part of a word when mode is `SegmenterUnicode`.
+	keep string
+}
+
+// newWordSegmenter returns a new `wordSegmenter` instance for 'mode' with additional 'separators' and 'keep' characters.
+func newWordSegmenter(mode string, separators string, keep string) (*wordSegmenter, error) {
+
+	switch mode {
+	case SegmenterWhitespace, SegmenterUnicode:
+		// pass
+	case "":
+		mode = SegmenterWhitespace
+	default:
+		return nil, fmt.Errorf("Unsupported segmenter '%s'", mode)
+	}
+
+	s := &wordSegmenter{
+		mode:       mode,
+		separators: separators,
+		keep:       keep,
+	}
+
+	return s, nil
+}
+
+// isSeparator reports whether 'r' separates words.
+func (s *wordSegmenter) isSeparator(r rune) bool {
+
+	if unicode.IsSpace(r) || strings.ContainsRune(s.separators, r) {
+		return true
+	}
+
+	if s.mode != SegmenterUnicode {
+		return false
+	}
+
+	if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) {
+		return false
+	}
+
+	return !strings.ContainsRune(s.keep, r)
+}
+
+// normalize returns 'text' with every separator which is not whitespace replaced by a single space. Since each
+// character is replaced by exactly one other character offsets in the normalized text map back to 'text'.
+func (s *wordSegmenter) normalize(text string) string {
+
+	if s.mode == SegmenterWhitespace && s.separators == "" {
+		return text
+	}
+
+	return strings.Map(func(r rune) rune {
+
+		if !unicode.IsSpace(r) && s.isSeparator(r) {
+			return ' '
+		}
+
+		return r
+	}, text)
+}
+
+// words returns the words in 'text'.
+func (s *wordSegmenter) words(text string) []string {
+	return strings.FieldsFunc(text, s.isSeparator)
+}
+
+// isCJK reports whether 'r' is a Chinese, Japanese or Korean character. Text in these scripts is not (necessarily)
+// delimited by whitespace.
+func isCJK(r rune) bool {
+
+	switch r {
+	case '々', '〆', 'ー', 'ｰ':
+		// iteration and prolonged sound marks which belong to the "Common" script
+		return true
+	}
+
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// isCJKWord reports whether every character in 'word' is a Chinese, Japanese or Korean character.
+func isCJKWord(word string) bool {
+
+	if word == "" {
+		return false
+	}
+
+	for _, r := range word {
+
+		if !isCJK(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// splitCJK returns 'words' with each word split in to separate words for each run of Chinese, Japanese or Korean
+// characters and each run of other characters. For example "tokyo東京" becomes "tokyo" and "東京".
+func splitCJK(words []string) []string {
+
+	split := make([]string, 0, len(words))
+
+	for _, w := range words {
+
+		start := 0
+		prev := false
+
+		for i, r := range w {
+
+			cjk := isCJK(r)
+
+			if i > 0 && cjk != prev {
+				split = append(split, w[start:i])
+				start = i
+			}
+
+			prev = cjk
+		}
+
+		if start < len(w) {
+			split = append(split, w[start:])
+		}
+	}
+
+	return split
+}
+
+// isIdentifierSeparator reports whether 'r' separates the parts of a snake_case or kebab-case identifier.
+func isIdentifierSeparator(r rune) bool {
+	return r == '_' || r == '-'
+}
+
+// splitIdentifier splits the (source code) identifier 'word' in to its parts. Parts are separated by "_" or "-" (snake_case
+// and kebab-case) or by changes in case (camelCase and PascalCase) such that "deriveBucketAndKey" becomes "derive", "Bucket",
+// "And" and "Key" and "HTTPServer" becomes "HTTP" and "Server".
+func splitIdentifier(word string) []string {
+
+	parts := make([]string, 0)
+	runes := []rune(word)
+
+	start := 0
+
+	appendPart := func(end int) {
+
+		if end > start {
+			parts = append(parts, string(runes[start:end]))
+		}
+	}
+
+	for i, r := range runes {
+
+		if isIdentifierSeparator(r) {
+			appendPart(i)
+			start = i + 1
+			continue
+		}
+
+		if i == start {
+			continue
+		}
+
+		prev := runes[i-1]
+
+		switch {
+		case unicode.IsUpper(r) && unicode.IsLower(prev), unicode.IsUpper(r) && unicode.IsDigit(prev):
+			// deriveBucket, utf8Reader
+			appendPart(i)
+			start = i
+		case unicode.IsLower(r) && unicode.IsUpper(prev) && i-1 > start:
+			// HTTPServer
+			appendPart(i - 1)
+			start = i - 1
+		}
+	}
+
+	appendPart(len(runes))
+	return parts
+}
+
+// joinIdentifier returns 'word' with every "-" replaced by "_" so that the snake_case and kebab-case forms of an identifier
+// are equivalent.
+func joinIdentifier(word string) string {
+	return strings.ReplaceAll(word, "-", "_")
+}
@@ -0,0 +1,415 @@
+package indexer
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestWordSegmenter(t *testing.T) {
+
+	tests := []struct {
+		mode       string
+		separators string
+		keep       string
+		text       string
+		words      []string
+		normalized string
+	}{
+		{SegmenterWhitespace, "", "", `{"name":"baz"} foo, (bar)`, []string{`{"name":"baz"}`, `foo,`, `(bar)`}, `{"name":"baz"} foo, (bar)`},
+		{"", "", "", "foo\tbar\nbaz", []string{"foo", "bar", "baz"}, "foo\tbar\nbaz"},
+		{SegmenterWhitespace, ",", "", "foo,bar baz", []string{"foo", "bar", "baz"}, "foo bar baz"},
+		{SegmenterUnicode, "", "", `{"name":"baz"} foo, (bar)`, []string{"name", "baz", "foo", "bar"}, `  name   baz   foo   bar `},
+		{SegmenterUnicode, "", "", "café naïve über", []string{"café", "naïve", "über"}, "café naïve über"},
+		{SegmenterUnicode, "", "", "café x2 ٣٤", []string{"café", "x2", "٣٤"}, "café x2 ٣٤"},
+		{SegmenterUnicode, "", "", "bucket_uri bucket-uri", []string{"bucket", "uri", "bucket", "uri"}, "bucket uri bucket uri"},
+		{SegmenterUnicode, "", "_", "bucket_uri bucket-uri", []string{"bucket_uri", "bucket", "uri"}, "bucket_uri bucket uri"},
+		{SegmenterUnicode, "é", "", "caféteria", []string{"caf", "teria"}, "caf teria"},
+		{SegmenterUnicode, "", "", "東京タワー", []string{"東京タワー"}, "東京タワー"},
+	}
+
+	for _, test := range tests {
+
+		s, err := newWordSegmenter(test.mode, test.separators, test.keep)
+
+		if err != nil {
+			t.Fatalf("Failed to create %s segmenter, %v", test.mode, err)
+		}
+
+		words := s.words(test.text)
+
+		if !slices.Equal(words, test.words) {
+			t.Fatalf("Unexpected words for %q using %s segmenter: %q (expected %q)", test.text, test.mode, words, test.words)
+		}
+
+		// each character is replaced by exactly one character so that offsets in normalized text map back to the original text
+
+		normalized := s.normalize(test.text)
+
+		if normalized != test.normalized {
+			t.Fatalf("Unexpected normalized text for %q using %s segmenter: %q (expected %q)", test.text, test.mode, normalized, test.normalized)
+		}
+	}
+
+	_, err := newWordSegmenter("sentences", "", "")
+
+	if err == nil {
+		t.Fatalf("Expected error creating unsupported segmenter")
+	}
+}
+
+func TestQueryUnicodeSegmenter(t *testing.T) {
+
+	ctx := context.Background()
+
+	tokenizer, err := NewTokenizer(ctx, "trigram://?segmenter=unicode")
+
+	if err != nil {
+		t.Fatalf("Failed to create tokenizer, %v", err)
+	}
+
+	// punctuation is not included in the tokens for a word
+
+	tokens := tokenizer.Tokenize(`{"name":"baz"}`)
+
+	if !slices.Contains(tokens, "nam") || !slices.Contains(tokens, "baz") || slices.Contains(tokens, `{"n`) {
+		t.Fatalf("Unexpected tokens: %q", tokens)
+	}
+
+	opts := DefaultIndexOptions()
+	opts.Tokenizer = tokenizer
+
+	idx, _ := newTestIndex(t, opts, map[string]string{
+		"a.json": `{"name":"baz","city":"new york"}`,
+		"b.txt":  "(bazaar) new, york",
+		"c.txt":  "bazbaz newyork",
+	})
+
+	tests := map[string][]string{
+		// terms match any part of a word
+		"baz":           {"a.json", "b.txt", "c.txt"},
+		"name":          {"a.json"},
+		`"name baz"`:    {"a.json"},
+		`"new york"`:    {"a.json", "b.txt"},
+		"bazaar":        {"b.txt"},
+		`"baz city"`:    {"a.json"},
+		`"york bazaar"`: {},
+	}
+
+	for q, expected := range tests {
+
+		paths := queryPaths(t, idx, q)
+
+		if !slices.Equal(paths, expected) {
+			t.Fatalf("Unexpected results for '%s': %v (expected %v)", q, paths, expected)
+		}
+	}
+}
+
+func TestSplitCJK(t *testing.T) {
+
+	tests := []struct {
+		words    []string
+		expected []string
+	}{
+		{[]string{"tokyo東京タワー"}, []string{"tokyo", "東京タワー"}},
+		{[]string{"東京tower2"}, []string{"東京", "tower2"}},
+		{[]string{"a東京b"}, []string{"a", "東京", "b"}},
+		{[]string{"北京", "beijing"}, []string{"北京", "beijing"}},
+		{[]string{"서울역seoul"}, []string{"서울역", "seoul"}},
+		// iteration and prolonged sound marks belong to the surrounding run
+		{[]string{"人々とスーパー"}, []string{"人々とスーパー"}},
+		{[]string{}, []string{}},
+	}
+
+	for _, test := range tests {
+
+		split := splitCJK(test.words)
+
+		if !slices.Equal(split, test.expected) {
+			t.Fatalf("Unexpected result splitting %q: %q (expected %q)", test.words, split, test.expected)
+		}
+	}
+
+	cjk_words := map[string]bool{
+		"東京":      true,
+		"ひらがな":    true,
+		"カタカナ":    true,
+		"한국어":     true,
+		"スーパー":    true,
+		"東京tower": false,
+		"tokyo":   false,
+		"":        false,
+	}
+
+	for word, expected := range cjk_words {
+
+		if isCJKWord(word) != expected {
+			t.Fatalf("Unexpected result for isCJKWord(%q): %t", word, !expected)
+		}
+	}
+}
+
+func TestTokenizeCJK(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		uri      string
+		text     string
+		expected []string
+		excluded []string
+	}{
+		// by default runs of CJK characters are part of the surrounding word and only trigrams are included
+		{"trigram://?phrases=false", "Tokyo東京タワー", []string{"tok", "o東京", "東京タ", "京タワ"}, []string{"東京", "tokyo"}},
+		// runs of CJK characters are separate words whose bigrams are included
+		{"trigram://?phrases=false&cjk=true", "Tokyo東京タワー", []string{"tok", "kyo", "東京", "京タ", "タワ", "ワー", "東京タ", "京タワ", "タワー"}, []string{"o東京", "yo東"}},
+		{"trigram://?phrases=false&cjk=true", "東京", []string{"東京"}, []string{}},
+		// bigrams are only included for CJK words
+		{"trigram://?phrases=false&cjk=true", "go 東京", []string{"東京"}, []string{"go"}},
+		// bigrams are not added twice when every word's bigrams are included
+		{"trigram://?phrases=false&cjk=true&min-length=2", "東京タ", []string{"東京", "京タ", "東京タ"}, []string{}},
+	}
+
+	for _, test := range tests {
+
+		tokenizer, err := NewTokenizer(ctx, test.uri)
+
+		if err != nil {
+			t.Fatalf("Failed to create tokenizer for %s, %v", test.uri, err)
+		}
+
+		tokens := tokenizer.Tokenize(test.text)
+
+		for _, token := range test.expected {
+
+			if !slices.Contains(tokens, token) {
+				t.Fatalf("Expected token '%s' for %q using %s, got %q", token, test.text, test.uri, tokens)
+			}
+		}
+
+		for _, token := range test.excluded {
+
+			if slices.Contains(tokens, token) {
+				t.Fatalf("Unexpected token '%s' for %q using %s, got %q", token, test.text, test.uri, tokens)
+			}
+		}
+	}
+
+	tokenizer, err := NewTokenizer(ctx, "trigram://?phrases=false&cjk=true&min-length=2")
+
+	if err != nil {
+		t.Fatalf("Failed to create tokenizer, %v", err)
+	}
+
+	tokens := tokenizer.Tokenize("東京タ")
+	count := 0
+
+	for _, token := range tokens {
+
+		if token == "東京" {
+			count += 1
+		}
+	}
+
+	if count != 1 {
+		t.Fatalf("Expected bigram to be included once, got %q", tokens)
+	}
+}
+
+func TestQueryCJK(t *testing.T) {
+
+	tokenizer, err := NewTokenizer(context.Background(), "trigram://?cjk=true")
+
+	if err != nil {
+		t.Fatalf("Failed to create tokenizer, %v", err)
+	}
+
+	opts := DefaultIndexOptions()
+	opts.Tokenizer = tokenizer
+
+	idx, _ := newTestIndex(t, opts, map[string]string{
+		"a.txt": "Tokyo東京タワーに行きました",
+		"b.txt": "京都に行きました",
+		"c.txt": "tokyo tower",
+	})
+
+	node, err := ParseQuery("東京")
+
+	if err != nil {
+		t.Fatalf("Failed to parse query, %v", err)
+	}
+
+	// two character words can be used to rule out documents
+
+	ids, err := idx.SearchQuery(node)
+
+	if err != nil {
+		t.Fatalf("Failed to search query, %v", err)
+	}
+
+	if !slices.Equal(ids, []uint32{0}) {
+		t.Fatalf("Unexpected candidates: %v", ids)
+	}
+
+	tests := map[string][]string{
+		"東京":        {"a.txt"},
+		"京":         {"a.txt", "b.txt"},
+		"行きました":     {"a.txt", "b.txt"},
+		"tokyo":     {"a.txt", "c.txt"},
+		"tokyo -東京": {"c.txt"},
+	}
+
+	for q, expected := range tests {
+
+		paths := queryPaths(t, idx, q)
+
+		if !slices.Equal(paths, expected) {
+			t.Fatalf("Unexpected results for '%s': %v (expected %v)", q, paths, expected)
+		}
+	}
+}
+
+func TestSplitIdentifier(t *testing.T) {
+
+	tests := []struct {
+		word     string
+		expected []string
+	}{
+		{"deriveBucketAndKey", []string{"derive", "Bucket", "And", "Key"}},
+		{"DeriveBucket", []string{"Derive", "Bucket"}},
+		{"HTTPServer", []string{"HTTP", "Server"}},
+		{"newHTTPServer", []string{"new", "HTTP", "Server"}},
+		{"ServeHTTP", []string{"Serve", "HTTP"}},
+		{"utf8Reader", []string{"utf8", "Reader"}},
+		{"bucket_uri", []string{"bucket", "uri"}},
+		{"BUCKET_URI", []string{"BUCKET", "URI"}},
+		{"bucket-uri", []string{"bucket", "uri"}},
+		{"snake_caseAndCamel", []string{"snake", "case", "And", "Camel"}},
+		// leading, trailing and repeated separators don't produce empty parts
+		{"_private", []string{"private"}},
+		{"trailing__", []string{"trailing"}},
+		{"a__b--c", []string{"a", "b", "c"}},
+		{"__", []string{}},
+		{"", []string{}},
+		// single words aren't split
+		{"bucket", []string{"bucket"}},
+		{"Bucket", []string{"Bucket"}},
+		{"HTTP", []string{"HTTP"}},
+		{"über", []string{"über"}},
+		{"straßeÜber", []string{"straße", "Über"}},
+	}
+
+	for _, test := range tests {
+
+		parts := splitIdentifier(test.word)
+
+		if !slices.Equal(parts, test.expected) {
+			t.Fatalf("Unexpected result splitting '%s': %q (expected %q)", test.word, parts, test.expected)
+		}
+	}
+
+	joined := map[string]string{
+		"bucket-uri":  "bucket_uri",
+		"bucket_uri":  "bucket_uri",
+		"a-b_c-d":     "a_b_c_d",
+		"bucketURI":   "bucketURI",
+		"-kebab-case": "_kebab_case",
+	}
+
+	for word, expected := range joined {
+
+		if joinIdentifier(word) != expected {
+			t.Fatalf("Unexpected result joining '%s': %s (expected %s)", word, joinIdentifier(word), expected)
+		}
+	}
+}
+
+func TestTokenizeCode(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		uri      string
+		text     string
+		expected []string
+		excluded []string
+	}{
+		// by default identifiers are single words
+		{"trigram://?phrases=false", "deriveBucketAndKey", []string{"der", "ebu", "buc", "dke"}, []string{"derive", "bucket"}},
+		// parts are separate words so trigrams spanning their boundaries only come from the whole identifier
+		{"trigram://?phrases=false&code=true", "deriveBucketAndKey", []string{"der", "ive", "buc", "ket", "and", "key", "ebu", "dke"}, []string{}},
+		{"trigram://?phrases=false&code=true", "bucket_uri", []string{"buc", "ket", "uri", "t_u"}, []string{"t-u"}},
+		// kebab-case identifiers are indexed in the same way as snake_case identifiers
+		{"trigram://?phrases=false&code=true", "bucket-uri", []string{"buc", "ket", "uri", "t_u"}, []string{"t-u"}},
+		{"trigram://?phrases=false&code=true", "HTTPServer", []string{"htt", "tps", "ser"}, []string{}},
+		// with a minimum length the parts of identifiers are words in their own right
+		{"trigram://?phrases=false&code=true&min-length=2", "newIOReader", []string{"new", "io", "rea"}, []string{}},
+	}
+
+	for _, test := range tests {
+
+		tokenizer, err := NewTokenizer(ctx, test.uri)
+
+		if err != nil {
+			t.Fatalf("Failed to create tokenizer for %s, %v", test.uri, err)
+		}
+
+		tokens := tokenizer.Tokenize(test.text)
+
+		for _, token := range test.expected {
+
+			if !slices.Contains(tokens, token) {
+				t.Fatalf("Expected token '%s' for %q using %s, got %q", token, test.text, test.uri, tokens)
+			}
+		}
+
+		for _, token := range test.excluded {
+
+			if slices.Contains(tokens, token) {
+				t.Fatalf("Unexpected token '%s' for %q using %s, got %q", token, test.text, test.uri, tokens)
+			}
+		}
+	}
+}
+
+func TestQueryCode(t *testing.T) {
+
+	tokenizer, err := NewTokenizer(context.Background(), "trigram://?code=true")
+
+	if err != nil {
+		t.Fatalf("Failed to create tokenizer, %v", err)
+	}
+
+	opts := DefaultIndexOptions()
+	opts.Tokenizer = tokenizer
+
+	idx, _ := newTestIndex(t, opts, map[string]string{
+		"a.go": "func deriveBucketAndKey(uri string)",
+		"b.go": "bucket_uri := flag.String()",
+		"c.go": "bucketUri := \"\"",
+		"d.go": "const BUCKET_KEY = \"key\"",
+	})
+
+	tests := map[string][]string{
+		"bucket":     {"a.go", "b.go", "c.go", "d.go"},
+		"key":        {"a.go", "d.go"},
+		"derive":     {"a.go"},
+		"bucket_uri": {"b.go"},
+		"bucket-uri": {"b.go"},
+		"bucketUri":  {"c.go"},
+		"bucket_key": {"d.go"},
+		// the whole identifier is matched, not its parts in any order
+		"key_bucket":   {},
+		`"bucket uri"`: {"b.go"},
+	}
+
+	for q, expected := range tests {
+
+		paths := queryPaths(t, idx, q)
+
+		if !slices.Equal(paths, expected) {
+			t.Fatalf("Unexpected results for '%s': %v (expected %v)", q, paths, expected)
+		}
+	}
+}
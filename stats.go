@@ -0,0 +1,185 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// IndexStatistics describes how full the bloom filter of an index is and the false positive rates that follow from that.
+type IndexStatistics struct {
+	// Documents is the number of (live) documents in the index.
+	Documents int
+	// BloomSize is the number of bits in the bloom filter for each document.
+	BloomSize int
+	// BloomHashes is the number of hash functions used for each token if the index has no `TermTable`.
+	BloomHashes int
+	// TermTableSize is the number of tokens listed in the index's `TermTable`, or -1 if it has none.
+	TermTableSize int
+	// Fill is the average fraction of the bits in each document's bloom filter which are set.
+	Fill float64
+	// FalsePositiveRates is the estimated probability that a document which does not contain a token is reported as a
+	// candidate for it, keyed by the number of hash functions used for the token.
+	FalsePositiveRates map[int]float64
+	// FalsePositiveRate is the estimated false positive rate for tokens which are hashed the default number of times (see
+	// `TermTable.DefaultHashes`), or for every token if the index has no `TermTable`.
+	FalsePositiveRate float64
+}
+
+// Statistics returns an `IndexStatistics` instance describing 'idx'. False positive rates are estimated, for each
+// document, as the fraction of bits set in its bloom filter raised to the power of the number of hash functions and
+// averaged over all documents.
+func (idx *Index) Statistics() *IndexStatistics {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	s := &IndexStatistics{
+		BloomSize:          idx.bloomSize,
+		BloomHashes:        idx.bloomHashes,
+		TermTableSize:      -1,
+		FalsePositiveRates: make(map[int]float64),
+	}
+
+	max_hashes := idx.bloomHashes
+
+	if idx.termTable != nil {
+		s.TermTableSize = len(idx.termTable.Hashes)
+		max_hashes = idx.termTable.maxHashes()
+	}
+
+	fills := make([]float64, 0, idx.currentDocumentCount)
+
+	for i := 0; i < len(idx.bloomFilter); i += idx.bloomSize {
+
+		var counts [DocumentsPerBlock]int
+
+		for _, word := range idx.bloomFilter[i : i+idx.bloomSize] {
+
+			for word != 0 {
+				j := bits.TrailingZeros64(word)
+				counts[j] += 1
+				word = word &^ (1 << j)
+			}
+		}
+
+		first := DocumentsPerBlock * (i / idx.bloomSize)
+
+		for j := 0; j < DocumentsPerBlock; j++ {
+
+			id := first + j
+
+			if id >= idx.currentDocumentCount {
+				break
+			}
+
+			if idx.tombstones[uint32(id)] {
+				continue
+			}
+
+			fills = append(fills, float64(counts[j])/float64(idx.bloomSize))
+		}
+	}
+
+	s.Documents = len(fills)
+
+	if s.Documents == 0 {
+		return s
+	}
+
+	for _, f := range fills {
+		s.Fill += f
+	}
+
+	s.Fill = s.Fill / float64(s.Documents)
+
+	for k := 1; k <= max_hashes; k++ {
+
+		rate := 0.0
+
+		for _, f := range fills {
+			rate += math.Pow(f, float64(k))
+		}
+
+		s.FalsePositiveRates[k] = rate / float64(s.Documents)
+	}
+
+	k := idx.bloomHashes
+
+	if idx.termTable != nil {
+		k = idx.termTable.DefaultHashes
+	}
+
+	s.FalsePositiveRate = s.FalsePositiveRates[k]
+	return s
+}
+
+// FalsePositiveMeasurement records the number of candidate documents reported by the bloom filter for a set of queries and
+// the number of those documents which were verified to match.
+type FalsePositiveMeasurement struct {
+	// Queries is the number of queries measured.
+	Queries int
+	// Candidates is the total number of candidate documents reported by the bloom filter.
+	Candidates int
+	// Matches is the total number of candidate documents which were verified to match.
+	Matches int
+}
+
+// FalsePositives returns the number of candidate documents which did not match.
+func (m *FalsePositiveMeasurement) FalsePositives() int {
+	return m.Candidates - m.Matches
+}
+
+// Rate returns the fraction of candidate documents which did not match.
+func (m *FalsePositiveMeasurement) Rate() float64 {
+
+	if m.Candidates == 0 {
+		return 0
+	}
+
+	return float64(m.FalsePositives()) / float64(m.Candidates)
+}
+
+// MeasureFalsePositives searches the index for each query in 'queries' (see `ParseQuery` for details) and returns the total
+// number of candidate documents reported by the bloom filter and the number of those which were verified to match.
+func (idx *Index) MeasureFalsePositives(ctx context.Context, queries []string) (*FalsePositiveMeasurement, error) {
+
+	m := &FalsePositiveMeasurement{}
+
+	for _, q := range queries {
+
+		node, err := ParseQuery(q)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse query '%s', %w", q, err)
+		}
+
+		// SearchQuery expands synonyms on its own
+		ids, err := idx.SearchQuery(node)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to search query '%s', %w", q, err)
+		}
+
+		matcher := newQueryMatcher(idx.ExpandSynonyms(node), idx.Tokenizer().Normalize)
+
+		for _, id := range ids {
+
+			r, err := idx.verifyDocument(ctx, id, matcher, 1)
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to verify document %d for query '%s', %w", id, q, err)
+			}
+
+			if r != nil {
+				m.Matches += 1
+			}
+		}
+
+		m.Queries += 1
+		m.Candidates += len(ids)
+	}
+
+	return m, nil
+}
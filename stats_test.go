@@ -0,0 +1,212 @@
+package indexer
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMeasureFalsePositives(t *testing.T) {
+
+	ctx := context.Background()
+
+	idx, _ := newTestIndex(t, DefaultIndexOptions(), map[string]string{
+		"a.txt": "hello world",
+		"b.txt": "world hello",
+		"c.txt": "goodbye world",
+		"d.txt": "lower hell",
+	})
+
+	queries := []string{
+		"hello",
+		`"hello world"`,
+		"world -goodbye",
+	}
+
+	m, err := idx.MeasureFalsePositives(ctx, queries)
+
+	if err != nil {
+		t.Fatalf("Failed to measure false positives, %v", err)
+	}
+
+	// negated terms are not used to rule out candidates so "goodbye world" is a candidate for the last query
+
+	if m.Queries != 3 || m.Candidates != 6 || m.Matches != 5 || m.FalsePositives() != 1 {
+		t.Fatalf("Unexpected measurement: %d queries, %d candidates, %d matches", m.Queries, m.Candidates, m.Matches)
+	}
+
+	if m.Rate() != 1.0/6 {
+		t.Fatalf("Unexpected false positive rate: %f", m.Rate())
+	}
+
+	_, err = idx.MeasureFalsePositives(ctx, []string{`"hello`})
+
+	if err == nil {
+		t.Fatalf("Expected error measuring invalid query")
+	}
+}
+
+func TestStatistics(t *testing.T) {
+
+	opts := DefaultIndexOptions()
+	opts.AdaptiveHashes = true
+
+	idx, _ := newTestIndex(t, opts, map[string]string{
+		"a.txt": "hello world",
+		"b.txt": "goodbye world",
+	})
+
+	err := idx.Remove(1)
+
+	if err != nil {
+		t.Fatalf("Failed to remove document, %v", err)
+	}
+
+	s := idx.Statistics()
+
+	if s.Documents != 1 || s.BloomSize != BloomSize || s.BloomHashes != BloomHashes {
+		t.Fatalf("Unexpected statistics: %d documents, bloom size %d, %d hashes", s.Documents, s.BloomSize, s.BloomHashes)
+	}
+
+	if s.TermTableSize != len(idx.TermTable().Hashes) {
+		t.Fatalf("Unexpected term table size: %d", s.TermTableSize)
+	}
+
+	if s.Fill <= 0 || s.Fill >= 1 {
+		t.Fatalf("Unexpected fill: %f", s.Fill)
+	}
+
+	for k := 2; k <= len(s.FalsePositiveRates); k++ {
+
+		if s.FalsePositiveRates[k] >= s.FalsePositiveRates[k-1] {
+			t.Fatalf("False positive rates should decrease with the number of hashes: %v", s.FalsePositiveRates)
+		}
+	}
+
+	if s.FalsePositiveRate != s.FalsePositiveRates[idx.TermTable().DefaultHashes] {
+		t.Fatalf("Unexpected false positive rate: %f", s.FalsePositiveRate)
+	}
+}
+
+// vendorQueries returns every 'n'th of the (sorted and distinct) identifiers, with at least 6 characters, in the Go files in
+// the 'vendor' directory.
+func vendorQueries(b *testing.B, n int) []string {
+
+	b.Helper()
+
+	re := regexp.MustCompile(`\b[A-Za-z][A-Za-z0-9]{5,}\b`)
+	seen := make(map[string]bool)
+
+	walk_cb := func(path string, d fs.DirEntry, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+
+		body, err := os.ReadFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		for _, id := range re.FindAllString(string(body), -1) {
+			seen[id] = true
+		}
+
+		return nil
+	}
+
+	err := filepath.WalkDir("vendor", walk_cb)
+
+	if err != nil {
+		b.Fatalf("Failed to read vendor directory, %v", err)
+	}
+
+	identifiers := make([]string, 0, len(seen))
+
+	for id := range seen {
+		identifiers = append(identifiers, id)
+	}
+
+	slices.Sort(identifiers)
+
+	queries := make([]string, 0)
+
+	for i := 0; i < len(identifiers); i += n {
+		queries = append(queries, identifiers[i])
+	}
+
+	return queries
+}
+
+// BenchmarkMeasureFalsePositives indexes this package's 'vendor' directory, with and without adaptive hash counts, and
+// reports the fraction of candidate documents which fail verification for identifiers sampled from those files. Run it
+// using `go test -run '^$' -bench MeasureFalsePositives -benchtime 1x`.
+func BenchmarkMeasureFalsePositives(b *testing.B) {
+
+	ctx := context.Background()
+
+	root, err := filepath.Abs("vendor")
+
+	if err != nil {
+		b.Fatalf("Failed to derive path for vendor directory, %v", err)
+	}
+
+	queries := vendorQueries(b, 100)
+
+	for _, adaptive := range []bool{false, true} {
+
+		name := "default"
+
+		if adaptive {
+			name = "adaptive"
+		}
+
+		b.Run(name, func(b *testing.B) {
+
+			opts := DefaultIndexOptions()
+			opts.AdaptiveHashes = adaptive
+
+			idx := NewIndexWithOptions(opts)
+			defer idx.Close()
+
+			err := idx.IndexBuckets(ctx, "file://"+filepath.ToSlash(root))
+
+			if err != nil {
+				b.Fatalf("Failed to index vendor directory, %v", err)
+			}
+
+			s := idx.Statistics()
+
+			b.ResetTimer()
+
+			var m *FalsePositiveMeasurement
+
+			for i := 0; i < b.N; i++ {
+
+				m, err = idx.MeasureFalsePositives(ctx, queries)
+
+				if err != nil {
+					b.Fatalf("Failed to measure false positives, %v", err)
+				}
+			}
+
+			b.ReportMetric(float64(s.Documents), "documents")
+			b.ReportMetric(float64(m.Queries), "queries")
+			b.ReportMetric(s.Fill*100, "fill-%")
+			b.ReportMetric(s.FalsePositiveRate*100, "estimated-fp-%")
+			b.ReportMetric(float64(m.Candidates), "candidates")
+			b.ReportMetric(float64(m.FalsePositives()), "false-positives")
+			b.ReportMetric(m.Rate()*100, "fp-%")
+		})
+	}
+}
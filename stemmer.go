@@ -0,0 +1,400 @@
+package indexer
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// stemmers are the built-in stemming functions keyed by language code.
+var stemmers = map[string]func(string) string{
+	LanguageEnglish: porterStem,
+}
+
+// wordStemmer reduces words to their stems so that, for example, "running" and "runs" are both indexed (and matched) as "run".
+type wordStemmer struct {
+	// language is the (optional) language code of the stemmer.
+	language string
+	stem     func(string) string
+}
+
+// newWordStemmer returns a new `wordStemmer` instance for the language code 'language'. If 'language' is empty words are
+// not stemmed.
+func newWordStemmer(language string) (*wordStemmer, error) {
+
+	s := &wordStemmer{
+		language: language,
+	}
+
+	if language == "" {
+		return s, nil
+	}
+
+	stem, ok := stemmers[language]
+
+	if !ok {
+		return nil, fmt.Errorf("Unsupported stemmer language '%s'", language)
+	}
+
+	s.stem = stem
+	return s, nil
+}
+
+// stemText returns 'text' with each run of letters replaced by its stem. Any other characters, including whitespace, are left
+// as-is so the same function can be applied to individual words and to whole documents.
+func (s *wordStemmer) stemText(text string) string {
+
+	if s.stem == nil {
+		return text
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(text))
+
+	start := -1
+
+	for i, r := range text {
+
+		if unicode.IsLetter(r) {
+
+			if start == -1 {
+				start = i
+			}
+
+			continue
+		}
+
+		if start != -1 {
+			sb.WriteString(s.stem(text[start:i]))
+			start = -1
+		}
+
+		sb.WriteRune(r)
+	}
+
+	if start != -1 {
+		sb.WriteString(s.stem(text[start:]))
+	}
+
+	return sb.String()
+}
+
+// porterStem returns the stem of the (lower-case) English word 'word' using the Porter stemming algorithm, as described
+// in https://tartarus.org/martin/PorterStemmer/. Words which contain characters other than "a" to "z" are returned as-is.
+func porterStem(word string) string {
+
+	if len(word) <= 2 {
+		return word
+	}
+
+	for i := 0; i < len(word); i++ {
+
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+
+	p := &porterStemmer{
+		b: []byte(word),
+		k: len(word) - 1,
+	}
+
+	p.step1ab()
+
+	if p.k > 0 {
+		p.step1c()
+		p.step2()
+		p.step3()
+		p.step4()
+		p.step5()
+	}
+
+	return string(p.b[:p.k+1])
+}
+
+// porterStemmer holds the state of a word being stemmed. b[0:k+1] is the word and j is a general offset in to it.
+type porterStemmer struct {
+	b []byte
+	k int
+	j int
+}
+
+// cons reports whether b[i] is a consonant.
+func (p *porterStemmer) cons(i int) bool {
+
+	switch p.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !p.cons(i-1)
+	default:
+		return true
+	}
+}
+
+// m returns the number of consonant sequences between 0 and j. If c is a consonant sequence and v a vowel sequence then
+//
+//	<c><v>       gives 0
+//	<c>vc<v>     gives 1
+//	<c>vcvc<v>   gives 2
+func (p *porterStemmer) m() int {
+
+	n := 0
+	i := 0
+
+	for {
+
+		if i > p.j {
+			return n
+		}
+
+		if !p.cons(i) {
+			break
+		}
+
+		i++
+	}
+
+	i++
+
+	for {
+
+		for {
+
+			if i > p.j {
+				return n
+			}
+
+			if p.cons(i) {
+				break
+			}
+
+			i++
+		}
+
+		i++
+		n++
+
+		for {
+
+			if i > p.j {
+				return n
+			}
+
+			if !p.cons(i) {
+				break
+			}
+
+			i++
+		}
+
+		i++
+	}
+}
+
+// vowelInStem reports whether b[0:j+1] contains a vowel.
+func (p *porterStemmer) vowelInStem() bool {
+
+	for i := 0; i <= p.j; i++ {
+
+		if !p.cons(i) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// doublec reports whether b[i-1:i+1] is a double consonant.
+func (p *porterStemmer) doublec(i int) bool {
+	return i >= 1 && p.b[i] == p.b[i-1] && p.cons(i)
+}
+
+// cvc reports whether b[i-2:i+1] is consonant-vowel-consonant and the second consonant is not "w", "x" or "y". This is used
+// when trying to restore an "e" at the end of a short word, for example "cav(e)", "lov(e)", "hop(e)" but "snow", "box", "tray".
+func (p *porterStemmer) cvc(i int) bool {
+
+	if i < 2 || !p.cons(i) || p.cons(i-1) || !p.cons(i-2) {
+		return false
+	}
+
+	switch p.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+
+	return true
+}
+
+// ends reports whether b[0:k+1] ends with 's', setting j to the offset before the suffix if it does.
+func (p *porterStemmer) ends(s string) bool {
+
+	l := len(s)
+
+	if l > p.k+1 {
+		return false
+	}
+
+	if string(p.b[p.k-l+1:p.k+1]) != s {
+		return false
+	}
+
+	p.j = p.k - l
+	return true
+}
+
+// setTo replaces b[j+1:k+1] with 's'.
+func (p *porterStemmer) setTo(s string) {
+	p.b = append(p.b[:p.j+1], s...)
+	p.k = p.j + len(s)
+}
+
+// r replaces the suffix with 's' if m() > 0.
+func (p *porterStemmer) r(s string) {
+
+	if p.m() > 0 {
+		p.setTo(s)
+	}
+}
+
+// replaceSuffix replaces the first suffix in 'suffixes', a list of suffix and replacement pairs, which b[0:k+1] ends with
+// using r.
+func (p *porterStemmer) replaceSuffix(suffixes [][2]string) {
+
+	for _, s := range suffixes {
+
+		if p.ends(s[0]) {
+			p.r(s[1])
+			return
+		}
+	}
+}
+
+// step1ab removes plurals and -ed or -ing. For example "caresses" becomes "caress", "ponies" becomes "poni", "agreed"
+// becomes "agree", "hopping" becomes "hop" and "filing" becomes "file".
+func (p *porterStemmer) step1ab() {
+
+	if p.b[p.k] == 's' {
+
+		switch {
+		case p.ends("sses"):
+			p.k -= 2
+		case p.ends("ies"):
+			p.setTo("i")
+		case p.b[p.k-1] != 's':
+			p.k--
+		}
+	}
+
+	if p.ends("eed") {
+
+		if p.m() > 0 {
+			p.k--
+		}
+
+		return
+	}
+
+	if !((p.ends("ed") || p.ends("ing")) && p.vowelInStem()) {
+		return
+	}
+
+	p.k = p.j
+
+	switch {
+	case p.ends("at"):
+		p.setTo("ate")
+	case p.ends("bl"):
+		p.setTo("ble")
+	case p.ends("iz"):
+		p.setTo("ize")
+	case p.doublec(p.k):
+
+		switch p.b[p.k] {
+		case 'l', 's', 'z':
+			// pass
+		default:
+			p.k--
+		}
+
+	default:
+
+		if p.m() == 1 && p.cvc(p.k) {
+			p.setTo("e")
+		}
+	}
+}
+
+// step1c turns a terminal "y" in to "i" when there is another vowel in the stem.
+func (p *porterStemmer) step1c() {
+
+	if p.ends("y") && p.vowelInStem() {
+		p.b[p.k] = 'i'
+	}
+}
+
+var porterStep2Suffixes = [][2]string{
+	{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"}, {"izer", "ize"}, {"bli", "ble"},
+	{"alli", "al"}, {"entli", "ent"}, {"eli", "e"}, {"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"},
+	{"ator", "ate"}, {"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"}, {"ousness", "ous"}, {"aliti", "al"},
+	{"iviti", "ive"}, {"biliti", "ble"}, {"logi", "log"},
+}
+
+// step2 maps double suffixes to single ones, for example "-ization" (= "-ize" plus "-ation") becomes "-ize".
+func (p *porterStemmer) step2() {
+	p.replaceSuffix(porterStep2Suffixes)
+}
+
+var porterStep3Suffixes = [][2]string{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"}, {"ical", "ic"}, {"ful", ""}, {"ness", ""},
+}
+
+// step3 deals with "-ic-", "-full", "-ness" etc. using a similar strategy to step2.
+func (p *porterStemmer) step3() {
+	p.replaceSuffix(porterStep3Suffixes)
+}
+
+var porterStep4Suffixes = []string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment", "ent", "ion", "ou", "ism", "ate", "iti",
+	"ous", "ive", "ize",
+}
+
+// step4 removes "-ant", "-ence" etc. in context <c>vcvc<v>.
+func (p *porterStemmer) step4() {
+
+	for _, s := range porterStep4Suffixes {
+
+		if !p.ends(s) {
+			continue
+		}
+
+		if s == "ion" && (p.j < 0 || (p.b[p.j] != 's' && p.b[p.j] != 't')) {
+			continue
+		}
+
+		if p.m() > 1 {
+			p.k = p.j
+		}
+
+		return
+	}
+}
+
+// step5 removes a final "-e" if m() > 1 and changes "-ll" to "-l" if m() > 1.
+func (p *porterStemmer) step5() {
+
+	p.j = p.k
+
+	if p.b[p.k] == 'e' {
+
+		a := p.m()
+
+		if a > 1 || (a == 1 && !p.cvc(p.k-1)) {
+			p.k--
+		}
+	}
+
+	if p.b[p.k] == 'l' && p.doublec(p.k) && p.m() > 1 {
+		p.k--
+	}
+}
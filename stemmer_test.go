@@ -0,0 +1,145 @@
+package indexer
+
+import (
+	"testing"
+)
+
+func TestPorterStem(t *testing.T) {
+
+	// a subset of the vocabulary, and its output, published with the reference implementation of the Porter stemming algorithm
+	tests := map[string]string{
+		// step 1a
+		"caresses": "caress",
+		"ponies":   "poni",
+		"ties":     "ti",
+		"caress":   "caress",
+		"cats":     "cat",
+		// step 1b
+		"feed":      "feed",
+		"agreed":    "agre",
+		"plastered": "plaster",
+		"bled":      "bled",
+		"motoring":  "motor",
+		"sing":      "sing",
+		"conflated": "conflat",
+		"troubled":  "troubl",
+		"sized":     "size",
+		"hopping":   "hop",
+		"tanned":    "tan",
+		"falling":   "fall",
+		"hissing":   "hiss",
+		"fizzed":    "fizz",
+		"failing":   "fail",
+		"filing":    "file",
+		// step 1c
+		"happy": "happi",
+		"sky":   "sky",
+		// step 2
+		"relational":     "relat",
+		"conditional":    "condit",
+		"rational":       "ration",
+		"valenci":        "valenc",
+		"hesitanci":      "hesit",
+		"digitizer":      "digit",
+		"conformabli":    "conform",
+		"radicalli":      "radic",
+		"differentli":    "differ",
+		"vileli":         "vile",
+		"analogousli":    "analog",
+		"vietnamization": "vietnam",
+		"predication":    "predic",
+		"operator":       "oper",
+		"feudalism":      "feudal",
+		"decisiveness":   "decis",
+		"hopefulness":    "hope",
+		"callousness":    "callous",
+		"formaliti":      "formal",
+		"sensitiviti":    "sensit",
+		"sensibiliti":    "sensibl",
+		// step 3
+		"triplicate":  "triplic",
+		"formative":   "form",
+		"formalize":   "formal",
+		"electriciti": "electr",
+		"electrical":  "electr",
+		"hopeful":     "hope",
+		"goodness":    "good",
+		// step 4
+		"revival":     "reviv",
+		"allowance":   "allow",
+		"inference":   "infer",
+		"airliner":    "airlin",
+		"gyroscopic":  "gyroscop",
+		"adjustable":  "adjust",
+		"defensible":  "defens",
+		"irritant":    "irrit",
+		"replacement": "replac",
+		"adjustment":  "adjust",
+		"dependent":   "depend",
+		"adoption":    "adopt",
+		"homologou":   "homolog",
+		"communism":   "commun",
+		"activate":    "activ",
+		"angulariti":  "angular",
+		"homologous":  "homolog",
+		"effective":   "effect",
+		"bowdlerize":  "bowdler",
+		// step 5
+		"probate":  "probat",
+		"rate":     "rate",
+		"cease":    "ceas",
+		"controll": "control",
+		"roll":     "roll",
+		// more than one step
+		"generalizations": "gener",
+		"running":         "run",
+		"runs":            "run",
+		// short words, and words which aren't lower-case English, are left as-is
+		"is":    "is",
+		"as":    "as",
+		"Cats":  "Cats",
+		"cafés": "cafés",
+		"mp3s":  "mp3s",
+	}
+
+	for word, expected := range tests {
+
+		actual := porterStem(word)
+
+		if actual != expected {
+			t.Fatalf("Unexpected stem for '%s': '%s' (expected '%s')", word, actual, expected)
+		}
+	}
+}
+
+func TestWordStemmer(t *testing.T) {
+
+	s, err := newWordStemmer(LanguageEnglish)
+
+	if err != nil {
+		t.Fatalf("Failed to create stemmer, %v", err)
+	}
+
+	actual := s.stemText("the ponies, running\tfast-ish 123 caresses")
+	expected := "the poni, run\tfast-ish 123 caress"
+
+	if actual != expected {
+		t.Fatalf("Unexpected stemmed text: '%s' (expected '%s')", actual, expected)
+	}
+
+	s, err = newWordStemmer("")
+
+	if err != nil {
+		t.Fatalf("Failed to create stemmer, %v", err)
+	}
+
+	if s.stemText("running ponies") != "running ponies" {
+		t.Fatalf("Empty stemmer should not change text")
+	}
+
+	_, err = newWordStemmer("xx")
+
+	if err == nil {
+		t.Fatalf("Expected error creating stemmer for unsupported language")
+	}
+}
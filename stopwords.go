@@ -0,0 +1,66 @@
+package indexer
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// LanguageEnglish is the language code for English stopwords and stemming.
+const LanguageEnglish = "en"
+
+// stopwords are the built-in lists of stopwords keyed by language code. Stopwords are so common that they don't help to
+// distinguish documents but they do fill the bloom filter.
+var stopwords = map[string][]string{
+	LanguageEnglish: []string{
+		"a", "an", "and", "are", "as", "at", "be", "but", "by", "for", "if", "in", "into", "is", "it", "no", "not", "of",
+		"on", "or", "such", "that", "the", "their", "then", "there", "these", "they", "this", "to", "was", "will", "with",
+	},
+}
+
+// stopwordList determines which words are excluded from the tokens produced for text.
+type stopwordList struct {
+	// language is the (optional) language code of the list.
+	language string
+	words    map[string]bool
+}
+
+// newStopwordList returns a new `stopwordList` instance for the language code 'language'. If 'language' is empty the list
+// is empty.
+func newStopwordList(language string) (*stopwordList, error) {
+
+	l := &stopwordList{
+		language: language,
+		words:    make(map[string]bool),
+	}
+
+	if language == "" {
+		return l, nil
+	}
+
+	words, ok := stopwords[language]
+
+	if !ok {
+		return nil, fmt.Errorf("Unsupported stopwords language '%s'", language)
+	}
+
+	for _, w := range words {
+		l.words[w] = true
+	}
+
+	return l, nil
+}
+
+// contains reports whether the (normalized) 'word', ignoring any leading or trailing punctuation, is a stopword.
+func (l *stopwordList) contains(word string) bool {
+
+	if len(l.words) == 0 {
+		return false
+	}
+
+	word = strings.TrimFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	return l.words[word]
+}
@@ -0,0 +1,120 @@
+package indexer
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestStopwordList(t *testing.T) {
+
+	l, err := newStopwordList(LanguageEnglish)
+
+	if err != nil {
+		t.Fatalf("Failed to create stopword list, %v", err)
+	}
+
+	tests := map[string]bool{
+		"the":      true,
+		"and":      true,
+		"(the":     true,
+		"and,":     true,
+		"\"with\"": true,
+		"then.":    true,
+		"they're":  false,
+		"theme":    false,
+		"york":     false,
+		"":         false,
+	}
+
+	for word, expected := range tests {
+
+		if l.contains(word) != expected {
+			t.Fatalf("Unexpected result for '%s': %t (expected %t)", word, !expected, expected)
+		}
+	}
+
+	l, err = newStopwordList("")
+
+	if err != nil {
+		t.Fatalf("Failed to create stopword list, %v", err)
+	}
+
+	if l.contains("the") {
+		t.Fatalf("Empty stopword list should not contain any words")
+	}
+
+	_, err = newStopwordList("xx")
+
+	if err == nil {
+		t.Fatalf("Expected error creating stopword list for unsupported language")
+	}
+}
+
+func TestTokenizeStopwords(t *testing.T) {
+
+	ctx := context.Background()
+
+	with_stopwords, err := NewTokenizer(ctx, "trigram://?stopwords=en&phrases=false")
+
+	if err != nil {
+		t.Fatalf("Failed to create tokenizer, %v", err)
+	}
+
+	without_stopwords, err := NewTokenizer(ctx, "trigram://?phrases=false")
+
+	if err != nil {
+		t.Fatalf("Failed to create tokenizer, %v", err)
+	}
+
+	text := "The cat and (the) dog, these are their toys"
+
+	tokens := with_stopwords.Tokenize(text)
+
+	for _, stopword := range []string{"the", "and", "the", "are", "the", "hes", "ese", "hei", "eir"} {
+
+		if slices.Contains(tokens, stopword) {
+			t.Fatalf("Unexpected token '%s' derived from a stopword in %v", stopword, tokens)
+		}
+	}
+
+	for _, token := range []string{"cat", "dog", "toy", "oys"} {
+
+		if !slices.Contains(tokens, token) {
+			t.Fatalf("Expected token '%s' in %v", token, tokens)
+		}
+	}
+
+	all_tokens := without_stopwords.Tokenize(text)
+
+	for _, token := range []string{"the", "and", "are", "hes", "eir"} {
+
+		if !slices.Contains(all_tokens, token) {
+			t.Fatalf("Expected token '%s' when stopwords are not removed in %v", token, all_tokens)
+		}
+	}
+
+	// stopwords are removed from the tokens used to search the index but are still matched when verifying results
+
+	if with_stopwords.Normalize(text) != without_stopwords.Normalize(text) {
+		t.Fatalf("Stopwords should not be removed from normalized text")
+	}
+
+	opts := DefaultIndexOptions()
+	opts.Tokenizer = with_stopwords
+
+	idx, _ := newTestIndex(t, opts, map[string]string{
+		"a.txt": "the cat and the dog",
+		"b.txt": "a cat or a dog",
+	})
+
+	results, err := idx.Query(ctx, `"cat and the dog"`, DefaultQueryOptions())
+
+	if err != nil {
+		t.Fatalf("Failed to query index, %v", err)
+	}
+
+	if len(results) != 1 || results[0].Id != 0 {
+		t.Fatalf("Unexpected results for phrase containing stopwords: %v", results)
+	}
+}
@@ -0,0 +1,198 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// StopSearch may be returned by a `SearchCallback` to stop a search without the search returning an error.
+var StopSearch = errors.New("stop search")
+
+// ErrIndexChanged is returned by `SearchFunc` if the index is renumbered (by `Update` or `Compact`) or replaced (by
+// `ImportArchive`) while a search is running.
+var ErrIndexChanged = errors.New("index changed during search")
+
+// SearchCallback is a function invoked for each verified result yielded by `SearchFunc`. If it returns an
+// error the search is stopped and, unless the error is `StopSearch`, that error is returned by `SearchFunc`.
+type SearchCallback func(context.Context, *Result) error
+
+// SearchFunc parses 'q' (see `ParseQuery` for details) and invokes 'cb' for each document which matches it, in document id
+// order, as soon as it has been verified. Candidate documents are read from the bloom filter one block at a time so results
+// are yielded before the whole index has been searched. The search stops once 'opts.MaxResults' results have been yielded or
+// 'ctx' is cancelled, including while a document is being read or verified, in which case the context's error is returned.
+// Each result is scored (see `Result.Score`) but, since results are yielded as they are found, 'opts.Sort' is ignored.
+// Terms and phrases are expanded using the index's synonyms (see `ExpandSynonyms`) so documents matching any synonym are
+// yielded.
+//
+// Because the index is not locked for the duration of the search any documents added while it is running may be included in
+// the results. If the index is renumbered (by `Update` or `Compact`) or replaced (by `ImportArchive`) while a search is running
+// the search stops, since the ids of the remaining candidates are no longer valid, and `ErrIndexChanged` is returned. Results
+// which have already been yielded are not affected.
+func (idx *Index) SearchFunc(ctx context.Context, q string, opts *QueryOptions, cb SearchCallback) error {
+
+	parse_opts := DefaultParseQueryOptions()
+	parse_opts.CaseSensitive = opts.CaseSensitive
+
+	node, err := ParseQueryWithOptions(q, parse_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to parse query, %w", err)
+	}
+
+	node = idx.ExpandSynonyms(node)
+
+	m := newQueryMatcher(node, idx.Tokenizer().Normalize)
+
+	m.scorer = idx.newResultScorer(m)
+
+	return idx.searchFunc(ctx, node, m, opts, cb)
+}
+
+// searchFunc evaluates 'candidate_node' against the bloom filter, one block at a time, and invokes 'cb' for each candidate
+// which is verified using 'm' (see `verifyDocument` for details).
+func (idx *Index) searchFunc(ctx context.Context, candidate_node QueryNode, m *queryMatcher, opts *QueryOptions, cb SearchCallback) error {
+
+	q, err := idx.compileQuery(candidate_node)
+
+	if err != nil {
+		return fmt.Errorf("Failed to compile query, %w", err)
+	}
+
+	count := 0
+
+	for block := 0; ; block++ {
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		ids, more, err := idx.blockCandidates(q, block)
+
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+
+			r, err := idx.verifyDocument(ctx, id, m, opts.MaxMatches)
+
+			if err != nil {
+				return err
+			}
+
+			// the document may have been renumbered, or read from a different index, while it was being verified
+
+			err = idx.checkGeneration(q)
+
+			if err != nil {
+				return err
+			}
+
+			if r == nil {
+				continue
+			}
+
+			err = cb(ctx, r)
+
+			if errors.Is(err, StopSearch) {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+
+			count += 1
+
+			if opts.MaxResults > 0 && count >= opts.MaxResults {
+				return nil
+			}
+		}
+
+		if !more {
+			return nil
+		}
+	}
+}
+
+// blockCandidates returns the ids of the documents in the (zero-indexed) block 'block' which might match 'q' and
+// a boolean value indicating whether there are any more blocks after it. If 'q' was not compiled for the current
+// generation of the index, because the index has been renumbered or replaced since the search started, `ErrIndexChanged`
+// is returned.
+func (idx *Index) blockCandidates(q *bloomQuery, block int) ([]uint32, bool, error) {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if q.generation != idx.generation {
+		return nil, false, ErrIndexChanged
+	}
+
+	offset := block * idx.bloomSize
+
+	if offset >= len(idx.bloomFilter) {
+		return nil, false, nil
+	}
+
+	more := offset+idx.bloomSize < len(idx.bloomFilter)
+
+	res := q.evaluate(idx.bloomFilter, offset)
+
+	if res == 0 {
+		return nil, more, nil
+	}
+
+	ids := make([]uint32, 0)
+	count := idx.currentDocumentCount
+
+	for j := 0; j < DocumentsPerBlock; j++ {
+
+		if res&(1<<j) == 0 {
+			continue
+		}
+
+		id := uint32(DocumentsPerBlock*block + j)
+
+		if int(id) >= count {
+			break
+		}
+
+		if idx.tombstones[id] {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, more, nil
+}
+
+// checkGeneration returns `ErrIndexChanged` if 'q' was not compiled for the current generation of the index.
+func (idx *Index) checkGeneration(q *bloomQuery) error {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if q.generation != idx.generation {
+		return ErrIndexChanged
+	}
+
+	return nil
+}
+
+// contextReader is an `io.Reader` which stops reading once its context has been cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+
+	if r.ctx.Err() != nil {
+		return 0, r.ctx.Err()
+	}
+
+	return r.r.Read(p)
+}
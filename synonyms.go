@@ -0,0 +1,229 @@
+package indexer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Synonyms is a dictionary of groups of equivalent terms and phrases, for example "sfo" and "san francisco international".
+// When a query is searched each term or phrase which belongs to a group is replaced by an OR expression matching any member
+// of that group.
+type Synonyms struct {
+	groups [][]string
+}
+
+// NewSynonyms returns a new `Synonyms` instance for 'groups' where each group is a list of equivalent terms or phrases.
+func NewSynonyms(groups [][]string) *Synonyms {
+
+	s := &Synonyms{
+		groups: make([][]string, 0, len(groups)),
+	}
+
+	for _, g := range groups {
+
+		group := make([]string, 0, len(g))
+
+		for _, v := range g {
+
+			v = strings.Join(strings.Fields(v), " ")
+
+			if v != "" {
+				group = append(group, v)
+			}
+		}
+
+		if len(group) > 1 {
+			s.groups = append(s.groups, group)
+		}
+	}
+
+	return s
+}
+
+// ReadSynonyms reads a synonym dictionary from 'r'. Each line is a comma-separated group of equivalent terms or phrases, for
+// example "sfo, san francisco international". Empty lines and lines starting with "#" are ignored.
+func ReadSynonyms(r io.Reader) (*Synonyms, error) {
+
+	groups := make([][]string, 0)
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		groups = append(groups, strings.Split(line, ","))
+	}
+
+	err := scanner.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read synonyms, %w", err)
+	}
+
+	return NewSynonyms(groups), nil
+}
+
+// ReadSynonymsWithURI reads a synonym dictionary (see `ReadSynonyms` for details) from 'uri' which is either the path of a
+// file on the local disk or a valid gocloud.dev/blob bucket URI containing the filename of the dictionary.
+func ReadSynonymsWithURI(ctx context.Context, uri string) (*Synonyms, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse synonyms URI, %w", err)
+	}
+
+	if u.Scheme == "" {
+
+		r, err := os.Open(uri)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open synonyms %s for reading, %w", uri, err)
+		}
+
+		defer r.Close()
+
+		return ReadSynonyms(r)
+	}
+
+	b, key, err := deriveBucketAndKey(ctx, uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open bucket (%s) derived from synonyms URI, %w", uri, err)
+	}
+
+	defer b.Close()
+
+	r, err := b.NewReader(ctx, key, nil)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open synonyms %s for reading, %w", key, err)
+	}
+
+	defer r.Close()
+
+	return ReadSynonyms(r)
+}
+
+// Groups returns the groups of equivalent terms and phrases in 's'.
+func (s *Synonyms) Groups() [][]string {
+	return s.groups
+}
+
+// expand returns 'node' with each term or (case-insensitive) phrase which belongs to a group in 's' replaced by an `OrNode`
+// matching any member of that group(s). Terms and phrases are compared once they have been normalized using 'normalize'.
+// Synonyms are not expanded transitively.
+func (s *Synonyms) expand(node QueryNode, normalize func(string) string) QueryNode {
+
+	if s == nil || len(s.groups) == 0 {
+		return node
+	}
+
+	key := func(text string) string {
+		return strings.Join(strings.Fields(normalize(text)), " ")
+	}
+
+	lookup := make(map[string][]int)
+
+	for i, g := range s.groups {
+
+		for _, v := range g {
+			k := key(v)
+			lookup[k] = append(lookup[k], i)
+		}
+	}
+
+	alternatives := func(node QueryNode, text string) QueryNode {
+
+		k := key(text)
+		groups, ok := lookup[k]
+
+		if !ok {
+			return node
+		}
+
+		or := &OrNode{
+			Nodes: []QueryNode{node},
+		}
+
+		seen := map[string]bool{
+			k: true,
+		}
+
+		for _, i := range groups {
+
+			for _, v := range s.groups[i] {
+
+				v_k := key(v)
+
+				if seen[v_k] {
+					continue
+				}
+
+				seen[v_k] = true
+
+				if len(strings.Fields(v)) > 1 {
+					or.Nodes = append(or.Nodes, &PhraseNode{Phrase: v})
+				} else {
+					or.Nodes = append(or.Nodes, &TermNode{Term: v})
+				}
+			}
+		}
+
+		return or
+	}
+
+	var walk func(QueryNode) QueryNode
+
+	walk = func(node QueryNode) QueryNode {
+
+		switch n := node.(type) {
+		case *TermNode:
+			return alternatives(n, n.Term)
+		case *PhraseNode:
+
+			if n.CaseSensitive {
+				return n
+			}
+
+			return alternatives(n, n.Phrase)
+
+		case *AndNode:
+
+			nodes := make([]QueryNode, len(n.Nodes))
+
+			for i, child := range n.Nodes {
+				nodes[i] = walk(child)
+			}
+
+			return &AndNode{Nodes: nodes}
+
+		case *OrNode:
+
+			nodes := make([]QueryNode, len(n.Nodes))
+
+			for i, child := range n.Nodes {
+				nodes[i] = walk(child)
+			}
+
+			return &OrNode{Nodes: nodes}
+
+		case *NotNode:
+			return &NotNode{Node: walk(n.Node)}
+		default:
+			return node
+		}
+	}
+
+	return walk(node)
+}
@@ -0,0 +1,177 @@
+package indexer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestSynonyms returns the `Synonyms` used by the tests in this file.
+func newTestSynonyms(t *testing.T) *Synonyms {
+
+	t.Helper()
+
+	dictionary := `
+# airports
+sfo, san francisco international
+
+nyc,  new   york , big apple
+car, automobile
+auto, car
+lonely,
+`
+
+	s, err := ReadSynonyms(strings.NewReader(dictionary))
+
+	if err != nil {
+		t.Fatalf("Failed to read synonyms, %v", err)
+	}
+
+	return s
+}
+
+func TestReadSynonyms(t *testing.T) {
+
+	s := newTestSynonyms(t)
+
+	// whitespace is collapsed and groups with a single member are ignored
+
+	expected := [][]string{
+		{"sfo", "san francisco international"},
+		{"nyc", "new york", "big apple"},
+		{"car", "automobile"},
+		{"auto", "car"},
+	}
+
+	groups := s.Groups()
+
+	if len(groups) != len(expected) {
+		t.Fatalf("Unexpected groups: %v", groups)
+	}
+
+	for i, g := range groups {
+
+		if !slices.Equal(g, expected[i]) {
+			t.Fatalf("Unexpected group %d: %v (expected %v)", i, g, expected[i])
+		}
+	}
+}
+
+func TestExpandSynonyms(t *testing.T) {
+
+	idx := NewIndex()
+	idx.SetSynonyms(newTestSynonyms(t))
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		// terms
+		{`sfo`, `OR(sfo, "san francisco international")`},
+		{`SFO`, `OR(SFO, "san francisco international")`},
+		{`boat`, `boat`},
+		// phrases
+		{`"san francisco international"`, `OR("san francisco international", sfo)`},
+		{`"San  Francisco International"`, `OR("San Francisco International", sfo)`},
+		{`"new york" pizza`, `AND(OR("new york", nyc, "big apple"), pizza)`},
+		{`"york pizza"`, `"york pizza"`},
+		// only whole terms or quoted phrases are expanded
+		{`san francisco international`, `AND(san, francisco, international)`},
+		// terms which belong to more than one group are expanded to every member of those groups, but not transitively
+		{`car`, `OR(car, automobile, auto)`},
+		{`auto`, `OR(auto, car)`},
+		{`automobile`, `OR(automobile, car)`},
+		// negation
+		{`-sfo`, `NOT(OR(sfo, "san francisco international"))`},
+		{`pizza -"big apple"`, `AND(pizza, NOT(OR("big apple", nyc, "new york")))`},
+		{`(nyc OR sfo) -car`, `AND(OR(OR(nyc, "new york", "big apple"), OR(sfo, "san francisco international")), NOT(OR(car, automobile, auto)))`},
+	}
+
+	for _, test := range tests {
+
+		node, err := ParseQuery(test.query)
+
+		if err != nil {
+			t.Fatalf("Failed to parse '%s', %v", test.query, err)
+		}
+
+		actual := describeQueryNode(idx.ExpandSynonyms(node))
+
+		if actual != test.expected {
+			t.Fatalf("Unexpected expansion of '%s': %s (expected %s)", test.query, actual, test.expected)
+		}
+	}
+
+	// case-sensitive phrases are not expanded
+
+	opts := DefaultParseQueryOptions()
+	opts.CaseSensitive = true
+
+	node, err := ParseQueryWithOptions(`"new york"`, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to parse query, %v", err)
+	}
+
+	actual := describeQueryNode(idx.ExpandSynonyms(node))
+
+	if actual != `"new york"/c` {
+		t.Fatalf("Unexpected expansion of case-sensitive phrase: %s", actual)
+	}
+
+	// an index without synonyms returns queries as-is
+
+	if NewIndex().ExpandSynonyms(node) != node {
+		t.Fatalf("Expected query to be returned as-is by an index without synonyms")
+	}
+}
+
+func TestQuerySynonyms(t *testing.T) {
+
+	opts := DefaultIndexOptions()
+	opts.Synonyms = newTestSynonyms(t)
+
+	idx, _ := newTestIndex(t, opts, map[string]string{
+		"a.txt": "I love New York",
+		"b.txt": "nyc pizza",
+		"c.txt": "the big apple has great pizza",
+		"d.txt": "san francisco pizza",
+	})
+
+	tests := map[string][]string{
+		"nyc":                   {"a.txt", "b.txt", "c.txt"},
+		`"big apple"`:           {"a.txt", "b.txt", "c.txt"},
+		"nyc -pizza":            {"a.txt"},
+		"pizza -nyc":            {"d.txt"},
+		`pizza -"new york"`:     {"d.txt"},
+		"sfo":                   {},
+		`"san francisco" pizza`: {"d.txt"},
+	}
+
+	for q, expected := range tests {
+
+		paths := queryPaths(t, idx, q)
+
+		if !slices.Equal(paths, expected) {
+			t.Fatalf("Unexpected results for '%s': %v (expected %v)", q, paths, expected)
+		}
+	}
+
+	// the candidates returned by SearchQuery account for synonyms too
+
+	node, err := ParseQuery("nyc")
+
+	if err != nil {
+		t.Fatalf("Failed to parse query, %v", err)
+	}
+
+	ids, err := idx.SearchQuery(node)
+
+	if err != nil {
+		t.Fatalf("Failed to search query, %v", err)
+	}
+
+	if !slices.Equal(ids, []uint32{0, 1, 2}) {
+		t.Fatalf("Unexpected candidates for query with synonyms: %v", ids)
+	}
+}
@@ -0,0 +1,292 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"gocloud.dev/blob"
+)
+
+// The document frequency (as a fraction of all documents) above which tokens are considered common.
+const commonTokenFrequency = 1.0 / 4
+
+// The document frequency (as a fraction of all documents) below which tokens are considered rare.
+const rareTokenFrequency = 1.0 / 1024
+
+// TermTable assigns the number of hash functions used to derive the bloom filter positions for each token according to
+// how common it is, in the style of BitFunnel. Tokens which occur in many documents are hashed fewer times, since the bits
+// they set are a large part of every document's bloom filter but do little to distinguish documents, and rare tokens are
+// hashed more times, which reduces the likelihood that documents which don't contain them are reported as candidates.
+type TermTable struct {
+	// Hashes is the number of hash functions used for each token which is not hashed the default number of times.
+	Hashes map[string]int
+	// DefaultHashes is the number of hash functions used for every other token, including tokens which had not been
+	// seen when the table was created.
+	DefaultHashes int
+}
+
+// termTableJSON is the JSON encoding of a `TermTable`. Tokens are grouped by the number of hash functions used for them
+// so that the number isn't repeated for every token.
+type termTableJSON struct {
+	DefaultHashes int              `json:"default_hashes"`
+	Tokens        map[int][]string `json:"tokens,omitempty"`
+	// Hashes is the number of hash functions used for each token in term tables encoded before tokens were grouped.
+	Hashes map[string]int `json:"hashes,omitempty"`
+}
+
+// MarshalJSON encodes 't' as JSON, listing the tokens (in order) for each number of hash functions.
+func (t *TermTable) MarshalJSON() ([]byte, error) {
+
+	enc := termTableJSON{
+		DefaultHashes: t.DefaultHashes,
+		Tokens:        make(map[int][]string),
+	}
+
+	for token, count := range t.Hashes {
+		enc.Tokens[count] = append(enc.Tokens[count], token)
+	}
+
+	for _, tokens := range enc.Tokens {
+		slices.Sort(tokens)
+	}
+
+	return json.Marshal(enc)
+}
+
+// UnmarshalJSON decodes 't' from JSON encoded using `MarshalJSON` or, for term tables encoded before tokens were grouped,
+// listing the number of hash functions for each token.
+func (t *TermTable) UnmarshalJSON(data []byte) error {
+
+	var enc termTableJSON
+
+	err := json.Unmarshal(data, &enc)
+
+	if err != nil {
+		return err
+	}
+
+	t.DefaultHashes = enc.DefaultHashes
+	t.Hashes = make(map[string]int)
+
+	for token, count := range enc.Hashes {
+		t.Hashes[token] = count
+	}
+
+	for count, tokens := range enc.Tokens {
+
+		for _, token := range tokens {
+			t.Hashes[token] = count
+		}
+	}
+
+	return nil
+}
+
+// NewTermTable returns a new `TermTable` derived from 'frequencies', the number of documents out of 'documents' that each
+// token occurs in, relative to 'hashes' hash functions. Tokens which occur in at least a quarter of all documents are assigned
+// 1 fewer hash function, tokens which occur in fewer than 1 in 1024 documents 1 more and tokens which occur in a single document
+// (or none) 2 more. The number of hash functions is always at least 1 and no more than 16. The number of hash functions
+// assigned to the most tokens is used as the default, so only the tokens which are assigned a different number are listed,
+// and tokens which had not been seen when the table was created are hashed the default number of times.
+func NewTermTable(frequencies map[string]int, documents int, hashes int) *TermTable {
+
+	clamp := func(count int) int {
+
+		if count < 1 {
+			return 1
+		}
+
+		if count > maxBloomHashes {
+			return maxBloomHashes
+		}
+
+		return count
+	}
+
+	t := &TermTable{
+		Hashes:        make(map[string]int),
+		DefaultHashes: clamp(hashes + 2),
+	}
+
+	if documents <= 0 {
+		return t
+	}
+
+	counts := make(map[string]int)
+
+	// the number of tokens assigned each number of hash functions
+	classes := make(map[int]int)
+
+	for token, df := range frequencies {
+
+		p := float64(df) / float64(documents)
+		count := hashes
+
+		switch {
+		case df <= 1:
+			count = hashes + 2
+		case p >= commonTokenFrequency:
+			count = hashes - 1
+		case p < rareTokenFrequency:
+			count = hashes + 1
+		}
+
+		count = clamp(count)
+
+		counts[token] = count
+		classes[count] += 1
+	}
+
+	// ties are resolved in favour of more hash functions since the default is also used for unseen (and so presumably rare) tokens
+
+	for count := maxBloomHashes; count >= 1; count-- {
+
+		if classes[count] > classes[t.DefaultHashes] {
+			t.DefaultHashes = count
+		}
+	}
+
+	for token, count := range counts {
+
+		if count != t.DefaultHashes {
+			t.Hashes[token] = count
+		}
+	}
+
+	return t
+}
+
+// HashCount returns the number of hash functions used to derive the bloom filter positions for 'token'.
+func (t *TermTable) HashCount(token string) int {
+
+	count, ok := t.Hashes[token]
+
+	if !ok {
+		return t.DefaultHashes
+	}
+
+	return count
+}
+
+// maxHashes returns the largest number of hash functions used for any token.
+func (t *TermTable) maxHashes() int {
+
+	max := t.DefaultHashes
+
+	for _, count := range t.Hashes {
+
+		if count > max {
+			max = count
+		}
+	}
+
+	return max
+}
+
+// validate ensures that every hash count in 't' is between 1 and 'max'.
+func (t *TermTable) validate(max int) error {
+
+	if t.DefaultHashes < 1 || t.DefaultHashes > max {
+		return fmt.Errorf("Invalid default hash count (%d)", t.DefaultHashes)
+	}
+
+	for token, count := range t.Hashes {
+
+		if count < 1 || count > max {
+			return fmt.Errorf("Invalid hash count (%d) for token '%s'", count, token)
+		}
+	}
+
+	return nil
+}
+
+// TermTable returns the `TermTable` used to assign the number of hash functions for each token, or nil if every token is
+// hashed using the same number of hash functions.
+func (idx *Index) TermTable() *TermTable {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.termTable
+}
+
+// hashCount returns the number of hash functions used to derive the bloom filter positions for 'token'. It assumes that
+// the caller holds a read lock.
+func (idx *Index) hashCount(token string) int {
+
+	if idx.termTable == nil {
+		return idx.bloomHashes
+	}
+
+	return idx.termTable.HashCount(token)
+}
+
+// needsTermTable reports whether a `TermTable` should be derived for the index. Term tables can only be derived before
+// any documents have been added since the bloom filter positions for their tokens depend on it.
+func (idx *Index) needsTermTable() bool {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.adaptiveHashes && idx.termTable == nil && idx.currentDocumentCount == 0
+}
+
+// buildTermTable reads and tokenizes every document in 'bucket_uris' to count the number of documents that each token
+// occurs in and assigns the index a `TermTable` derived from those counts. It assumes that the caller holds the writer lock.
+func (idx *Index) buildTermTable(ctx context.Context, bucket_uris ...string) error {
+
+	frequencies := make(map[string]int)
+	documents := 0
+
+	for _, uri := range bucket_uris {
+
+		b, err := idx.openBucket(ctx, uri)
+
+		if err != nil {
+			return fmt.Errorf("Failed to open bucket for '%s', %w", uri, err)
+		}
+
+		walk_cb := func(ctx context.Context, obj *blob.ListObject) error {
+
+			if obj.IsDir {
+				return nil
+			}
+
+			text, ok := idx.readDocumentText(ctx, b, obj)
+
+			if !ok {
+				return nil
+			}
+
+			seen := make(map[string]bool)
+
+			for _, token := range idx.Tokenize(text) {
+
+				if seen[token] {
+					continue
+				}
+
+				seen[token] = true
+				frequencies[token] += 1
+			}
+
+			documents += 1
+			return nil
+		}
+
+		err = idx.walkBucket(ctx, b, walk_cb)
+
+		if err != nil {
+			return fmt.Errorf("Failed to count token frequencies for '%s', %w", uri, err)
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.termTable = NewTermTable(frequencies, documents, idx.bloomHashes)
+	idx.generation += 1
+	return nil
+}
@@ -0,0 +1,130 @@
+package indexer
+
+import (
+	"encoding/json"
+	"maps"
+	"testing"
+)
+
+func TestNewTermTable(t *testing.T) {
+
+	frequencies := map[string]int{
+		// common
+		"the": 500,
+		"and": 300,
+		// everything else
+		"cat": 10,
+		"dog": 20,
+		"owl": 2,
+		"fox": 3,
+		"yak": 4,
+		// single document
+		"emu": 1,
+		"gnu": 1,
+	}
+
+	tt := NewTermTable(frequencies, 1000, 3)
+
+	// most tokens are hashed 3 times so only the others are listed
+	expected := map[string]int{
+		"the": 2,
+		"and": 2,
+		"emu": 5,
+		"gnu": 5,
+	}
+
+	if tt.DefaultHashes != 3 {
+		t.Fatalf("Unexpected default hash count: %d", tt.DefaultHashes)
+	}
+
+	if !maps.Equal(tt.Hashes, expected) {
+		t.Fatalf("Unexpected hash counts: %v", tt.Hashes)
+	}
+
+	for token, df := range frequencies {
+
+		count := tt.HashCount(token)
+
+		if df == 1 && count != 5 || df >= 250 && count != 2 || df > 1 && df < 250 && count != 3 {
+			t.Fatalf("Unexpected hash count for '%s' (%d documents): %d", token, df, count)
+		}
+	}
+
+	if tt.HashCount("unseen") != 3 {
+		t.Fatalf("Unexpected hash count for unseen token: %d", tt.HashCount("unseen"))
+	}
+
+	// if most tokens occur in a single document they are the default
+
+	tt = NewTermTable(map[string]int{"the": 10, "cat": 1, "dog": 1, "owl": 1}, 10, 3)
+
+	if tt.DefaultHashes != 5 || !maps.Equal(tt.Hashes, map[string]int{"the": 2}) {
+		t.Fatalf("Unexpected term table: %d, %v", tt.DefaultHashes, tt.Hashes)
+	}
+
+	// ties are resolved in favour of more hash functions
+
+	tt = NewTermTable(map[string]int{"the": 10, "cat": 1}, 10, 3)
+
+	if tt.DefaultHashes != 5 || !maps.Equal(tt.Hashes, map[string]int{"the": 2}) {
+		t.Fatalf("Unexpected term table for tie: %d, %v", tt.DefaultHashes, tt.Hashes)
+	}
+
+	// hash counts are clamped
+
+	tt = NewTermTable(map[string]int{"the": 10, "cat": 2, "dog": 1}, 10, 1)
+
+	if tt.HashCount("the") != 1 || tt.HashCount("cat") != 1 || tt.HashCount("dog") != 3 {
+		t.Fatalf("Unexpected clamped hash counts: %d, %v", tt.DefaultHashes, tt.Hashes)
+	}
+
+	tt = NewTermTable(nil, 0, 3)
+
+	if tt.DefaultHashes != 5 || len(tt.Hashes) != 0 {
+		t.Fatalf("Unexpected term table for no documents: %d, %v", tt.DefaultHashes, tt.Hashes)
+	}
+}
+
+func TestTermTableJSON(t *testing.T) {
+
+	tt := &TermTable{
+		Hashes: map[string]int{
+			"the": 2,
+			"and": 2,
+			"emu": 5,
+		},
+		DefaultHashes: 3,
+	}
+
+	enc, err := json.Marshal(tt)
+
+	if err != nil {
+		t.Fatalf("Failed to encode term table, %v", err)
+	}
+
+	expected := `{"default_hashes":3,"tokens":{"2":["and","the"],"5":["emu"]}}`
+
+	if string(enc) != expected {
+		t.Fatalf("Unexpected encoding: %s (expected %s)", enc, expected)
+	}
+
+	tests := []string{
+		expected,
+		`{"default_hashes":3,"hashes":{"the":2,"and":2,"emu":5}}`,
+	}
+
+	for _, enc := range tests {
+
+		var decoded *TermTable
+
+		err := json.Unmarshal([]byte(enc), &decoded)
+
+		if err != nil {
+			t.Fatalf("Failed to decode %s, %v", enc, err)
+		}
+
+		if decoded.DefaultHashes != tt.DefaultHashes || !maps.Equal(decoded.Hashes, tt.Hashes) {
+			t.Fatalf("Unexpected term table decoded from %s: %d, %v", enc, decoded.DefaultHashes, decoded.Hashes)
+		}
+	}
+}
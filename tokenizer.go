@@ -0,0 +1,492 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Tokenizer is an interface for deriving the tokens which are stored in, and queried from, the bloom filter of an index.
+type Tokenizer interface {
+	// Tokenize returns the tokens for 'text'. The same method is used to tokenize documents and queries.
+	Tokenize(text string) []string
+	// Normalize returns 'text' in the normalized form used to derive tokens (for example lower-cased). It is used to
+	// verify candidate documents so that a query term matches text which produces the same tokens.
+	Normalize(text string) string
+	// URI returns a URI which can be passed to `NewTokenizer` to create an equivalent `Tokenizer`. It is recorded in
+	// archives so that imported indices are searched using the same tokenizer they were created with.
+	URI() string
+}
+
+// TokenizerInitializationFunc is a function used to initialize an implementation of the `Tokenizer` interface.
+type TokenizerInitializationFunc func(ctx context.Context, uri string) (Tokenizer, error)
+
+var tokenizers_mu sync.RWMutex
+
+var tokenizers = make(map[string]TokenizerInitializationFunc)
+
+func init() {
+
+	ctx := context.Background()
+
+	for _, method := range trigramMethods {
+
+		err := RegisterTokenizer(ctx, trigramSchemeForMethod(method), NewTrigramTokenizer)
+
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterTokenizer registers 'init_func' as the function used to create `Tokenizer` instances for URIs whose scheme is 'scheme'.
+func RegisterTokenizer(ctx context.Context, scheme string, init_func TokenizerInitializationFunc) error {
+
+	tokenizers_mu.Lock()
+	defer tokenizers_mu.Unlock()
+
+	_, exists := tokenizers[scheme]
+
+	if exists {
+		return fmt.Errorf("Tokenizer scheme '%s' has already been registered", scheme)
+	}
+
+	tokenizers[scheme] = init_func
+	return nil
+}
+
+// NewTokenizer returns a new `Tokenizer` instance for 'uri' using the initialization function registered for its scheme.
+func NewTokenizer(ctx context.Context, uri string) (Tokenizer, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse tokenizer URI, %w", err)
+	}
+
+	tokenizers_mu.RLock()
+	init_func, exists := tokenizers[u.Scheme]
+	tokenizers_mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("Unsupported tokenizer scheme '%s'", u.Scheme)
+	}
+
+	return init_func(ctx, uri)
+}
+
+// TokenizerSchemes returns the sorted list of schemes for which `Tokenizer` implementations have been registered.
+func TokenizerSchemes() []string {
+
+	tokenizers_mu.RLock()
+	defer tokenizers_mu.RUnlock()
+
+	schemes := make([]string, 0, len(tokenizers))
+
+	for s := range tokenizers {
+		schemes = append(schemes, s+"://")
+	}
+
+	sort.Strings(schemes)
+	return schemes
+}
+
+// The default minimum length, in characters, of the tokens produced by `trigramTokenizer`.
+const defaultTokenMinLength = 3
+
+// trigramTokenizer implements the `Tokenizer` interface for the trigram methods in `trigram.go`. Text is lower-cased (and
+// optionally normalized and folded) and split in to words. Stopwords are (optionally) removed and the remaining words are
+// (optionally) stemmed. Words with at least 3 characters are split in to trigrams. If the minimum token length is less
+// than 3 then the unigrams and/or bigrams of every word are also included. Unless disabled the trigrams spanning adjacent
+// words (see `SpanningTrigrams`) are also included.
+type trigramTokenizer struct {
+	method    string
+	phrases   bool
+	segmenter *wordSegmenter
+	folder    *textFolder
+	// cjk signals that runs of Chinese, Japanese or Korean characters should be treated as separate words and that their
+	// bigrams, as well as their trigrams, should be included.
+	cjk bool
+	// code signals that (source code) identifiers should be split in to their parts, which are treated as separate words,
+	// in addition to the identifier itself.
+	code bool
+	// stopwords are the words which are excluded from the tokens produced by the tokenizer.
+	stopwords *stopwordList
+	// stemmer reduces words to their stems before they are split in to trigrams.
+	stemmer *wordStemmer
+	// minLength is the minimum length, in characters, of the tokens produced by the tokenizer (1, 2 or 3).
+	minLength int
+}
+
+// NewTrigramTokenizer returns a new `Tokenizer` instance for 'uri' which is expected to take the form of:
+//
+//	{METHOD}://?{PARAMETERS}
+//
+// Where {METHOD} is "trigram" (the default method) or the name of one of the other trigram methods ("merovius", "dancantos",
+// "ffmiruz" or "jamesrom"). Valid parameters are:
+// * `phrases` – A boolean value indicating whether the trigrams spanning adjacent words should be included. Default is true.
+// * `segmenter` – How text is split in to words: "whitespace" (words are separated by whitespace) or "unicode" (words are runs
+// of letters, digits and marks). Default is "whitespace".
+// * `separators` – Additional characters which separate words.
+// * `keep` – Additional characters which are part of words when the "unicode" segmenter is used (for example "_").
+// * `min-length` – The minimum length, in characters, of the tokens produced for each word. If less than 3 the unigrams and/or
+// bigrams of each word are included so that queries for 1 or 2 character terms can be pre-screened. Default is 3.
+// * `normalize` – The Unicode normalization form ("nfc" or "nfkc") applied to text before it is tokenized. Default is none.
+// * `fold` – A comma-separated list of foldings applied to text before it is tokenized: "case" (simple case folding rather than
+// lower-casing) and "accents" (remove diacritical marks). Default is none.
+// * `cjk` – A boolean value indicating whether runs of Chinese, Japanese or Korean characters, which are not delimited by
+// whitespace, should be treated as separate words whose character bigrams and trigrams are included. Default is false.
+// * `code` – A boolean value indicating whether camelCase, PascalCase, snake_case and kebab-case identifiers should be split
+// in to their parts, which are treated as separate words, in addition to including the identifier itself. Default is false.
+// * `stopwords` – The language code ("en") of the list of stopwords to exclude from the tokens produced. Default is none.
+// * `stem` – The language code ("en") of the stemmer used to reduce words to their stems before they are split in to trigrams.
+// Default is none.
+func NewTrigramTokenizer(ctx context.Context, uri string) (Tokenizer, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse tokenizer URI, %w", err)
+	}
+
+	method := trigramMethodForScheme(u.Scheme)
+
+	if method == "" {
+		return nil, fmt.Errorf("Unsupported trigram method '%s'", u.Scheme)
+	}
+
+	t := newTrigramTokenizer(method, true)
+
+	q := u.Query()
+
+	if q.Has("phrases") {
+
+		phrases, err := strconv.ParseBool(q.Get("phrases"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ?phrases= parameter, %w", err)
+		}
+
+		t.phrases = phrases
+	}
+
+	segmenter, err := newWordSegmenter(q.Get("segmenter"), q.Get("separators"), q.Get("keep"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	t.segmenter = segmenter
+
+	folder, err := newTextFolder(q.Get("normalize"), q.Get("fold"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	t.folder = folder
+
+	stopwords, err := newStopwordList(q.Get("stopwords"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	t.stopwords = stopwords
+
+	stemmer, err := newWordStemmer(q.Get("stem"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	t.stemmer = stemmer
+
+	if q.Has("cjk") {
+
+		cjk, err := strconv.ParseBool(q.Get("cjk"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ?cjk= parameter, %w", err)
+		}
+
+		t.cjk = cjk
+	}
+
+	if q.Has("code") {
+
+		code, err := strconv.ParseBool(q.Get("code"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ?code= parameter, %w", err)
+		}
+
+		t.code = code
+	}
+
+	if q.Has("min-length") {
+
+		min_length, err := strconv.Atoi(q.Get("min-length"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ?min-length= parameter, %w", err)
+		}
+
+		if min_length < 1 || min_length > defaultTokenMinLength {
+			return nil, fmt.Errorf("Invalid ?min-length= parameter, must be between 1 and %d", defaultTokenMinLength)
+		}
+
+		t.minLength = min_length
+	}
+
+	return t, nil
+}
+
+// newTrigramTokenizer returns a new `trigramTokenizer` for 'method', where unknown methods are treated as "default".
+func newTrigramTokenizer(method string, phrases bool) *trigramTokenizer {
+
+	if trigramSchemeForMethod(method) == "" {
+		method = "default"
+	}
+
+	segmenter, _ := newWordSegmenter(SegmenterWhitespace, "", "")
+	folder, _ := newTextFolder("", "")
+	stopwords, _ := newStopwordList("")
+	stemmer, _ := newWordStemmer("")
+
+	t := &trigramTokenizer{
+		method:    method,
+		phrases:   phrases,
+		segmenter: segmenter,
+		folder:    folder,
+		stopwords: stopwords,
+		stemmer:   stemmer,
+		minLength: defaultTokenMinLength,
+	}
+
+	return t
+}
+
+// trigramSchemeForMethod returns the tokenizer URI scheme for the trigram method 'method'.
+func trigramSchemeForMethod(method string) string {
+
+	switch method {
+	case "default":
+		return "trigram"
+	case "merovius", "dancantos", "ffmiruz", "jamesrom":
+		return method
+	default:
+		return ""
+	}
+}
+
+// trigramMethodForScheme returns the trigram method for the tokenizer URI scheme 'scheme'.
+func trigramMethodForScheme(scheme string) string {
+
+	for _, method := range trigramMethods {
+
+		if trigramSchemeForMethod(method) == scheme {
+			return method
+		}
+	}
+
+	return ""
+}
+
+func (t *trigramTokenizer) Tokenize(text string) []string {
+
+	res, identifiers := t.words(text)
+
+	var cres []string
+	for _, v := range res {
+		if utf8.RuneCountInString(v) >= 3 {
+			cres = append(cres, v)
+		}
+	}
+
+	// whole identifiers are trigrammed but are not included in the words used to derive spanning trigrams
+	for _, v := range identifiers {
+		if utf8.RuneCountInString(v) >= 3 {
+			cres = append(cres, v)
+		}
+	}
+
+	var trigrams []string
+
+	// short tokens are derived from every word so that a short query term matches any word which contains it
+	for size := t.minLength; size < defaultTokenMinLength; size++ {
+		for _, r := range res {
+			trigrams = append(trigrams, Ngrams(r, size)...)
+		}
+	}
+
+	// words in languages which are not delimited by whitespace are indexed using their bigrams as well
+	if t.cjk && t.minLength > 2 {
+		for _, r := range res {
+			if isCJKWord(r) {
+				trigrams = append(trigrams, Ngrams(r, 2)...)
+			}
+		}
+	}
+
+	// now we have clean tokens trigram them
+	for _, r := range cres {
+		switch t.method {
+		case "merovius":
+			trigrams = append(trigrams, TrigramsMerovius(r)...)
+		case "dancantos":
+			trigrams = append(trigrams, TrigramsDancantos(r)...)
+		case "ffmiruz":
+			trigrams = append(trigrams, TrigramsFfmiruz(r)...)
+		case "jamesrom":
+			for _, t := range TrigramsJamesrom(r) {
+				trigrams = append(trigrams, string(t.Bytes()))
+			}
+		default:
+			trigrams = append(trigrams, Trigrams(r)...)
+		}
+
+	}
+
+	// add the trigrams which span adjacent words so that phrases can be used to pre-screen documents
+	if t.phrases {
+		for i := 1; i < len(res); i++ {
+			trigrams = append(trigrams, SpanningTrigrams(res[i-1], res[i])...)
+		}
+	}
+
+	return trigrams
+}
+
+// words returns the (normalized) words in 'text' and, if identifiers are being split, the (normalized) identifiers
+// which were split in to more than one word.
+func (t *trigramTokenizer) words(text string) ([]string, []string) {
+
+	var words []string
+	var identifiers []string
+
+	if t.code {
+
+		// identifiers are split before text is folded since folding removes the case changes between their parts
+
+		for _, w := range t.segmenter.words(text) {
+
+			parts := splitIdentifier(w)
+
+			if len(parts) > 1 {
+				identifiers = append(identifiers, t.stemmer.stemText(t.folder.fold(joinIdentifier(w))))
+			}
+
+			for _, p := range parts {
+				words = append(words, t.folder.fold(p))
+			}
+		}
+
+	} else {
+		words = t.segmenter.words(t.folder.fold(text))
+	}
+
+	if len(t.stopwords.words) > 0 || t.stemmer.stem != nil {
+
+		stemmed := make([]string, 0, len(words))
+
+		for _, w := range words {
+
+			if t.stopwords.contains(w) {
+				continue
+			}
+
+			stemmed = append(stemmed, t.stemmer.stemText(w))
+		}
+
+		words = stemmed
+	}
+
+	if t.cjk {
+		words = splitCJK(words)
+	}
+
+	return words, identifiers
+}
+
+func (t *trigramTokenizer) Normalize(text string) string {
+
+	text = t.segmenter.normalize(t.folder.fold(text))
+
+	if t.code {
+
+		text = strings.Map(func(r rune) rune {
+
+			if isIdentifierSeparator(r) {
+				return ' '
+			}
+
+			return r
+		}, text)
+	}
+
+	// stopwords are not removed from normalized text since they are still matched when verifying search results
+	return t.stemmer.stemText(text)
+}
+
+func (t *trigramTokenizer) URI() string {
+
+	q := url.Values{}
+
+	if !t.phrases {
+		q.Set("phrases", "false")
+	}
+
+	if t.segmenter.mode != SegmenterWhitespace {
+		q.Set("segmenter", t.segmenter.mode)
+	}
+
+	if t.segmenter.separators != "" {
+		q.Set("separators", t.segmenter.separators)
+	}
+
+	if t.segmenter.keep != "" {
+		q.Set("keep", t.segmenter.keep)
+	}
+
+	if t.folder.form != "" {
+		q.Set("normalize", t.folder.form)
+	}
+
+	if t.folder.folds() != "" {
+		q.Set("fold", t.folder.folds())
+	}
+
+	if t.cjk {
+		q.Set("cjk", "true")
+	}
+
+	if t.code {
+		q.Set("code", "true")
+	}
+
+	if t.stopwords.language != "" {
+		q.Set("stopwords", t.stopwords.language)
+	}
+
+	if t.stemmer.language != "" {
+		q.Set("stem", t.stemmer.language)
+	}
+
+	if t.minLength != defaultTokenMinLength {
+		q.Set("min-length", strconv.Itoa(t.minLength))
+	}
+
+	uri := trigramSchemeForMethod(t.method) + "://"
+
+	if len(q) > 0 {
+		uri = uri + "?" + q.Encode()
+	}
+
+	return uri
+}
@@ -0,0 +1,227 @@
+package indexer
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestTokenizerURI(t *testing.T) {
+
+	ctx := context.Background()
+
+	// tokenizer URIs and their canonical form, as returned by `Tokenizer.URI`
+
+	tests := []struct {
+		uri      string
+		expected string
+	}{
+		{"trigram://", "trigram://"},
+		{"merovius://", "merovius://"},
+		{"dancantos://", "dancantos://"},
+		{"ffmiruz://", "ffmiruz://"},
+		{"jamesrom://", "jamesrom://"},
+		{"trigram://?phrases=false", "trigram://?phrases=false"},
+		{"trigram://?segmenter=unicode", "trigram://?segmenter=unicode"},
+		{"trigram://?segmenter=unicode&keep=_&separators=/", "trigram://?keep=_&segmenter=unicode&separators=%2F"},
+		{"trigram://?normalize=nfkc&fold=accents", "trigram://?fold=accents&normalize=nfkc"},
+		{"trigram://?fold=accents,case", "trigram://?fold=case%2Caccents"},
+		{"trigram://?cjk=true", "trigram://?cjk=true"},
+		{"trigram://?code=true", "trigram://?code=true"},
+		{"trigram://?stopwords=en&stem=en", "trigram://?stem=en&stopwords=en"},
+		{"trigram://?min-length=1", "trigram://?min-length=1"},
+		{"jamesrom://?min-length=2&phrases=false", "jamesrom://?min-length=2&phrases=false"},
+		{"ffmiruz://?code=true&cjk=true&segmenter=unicode", "ffmiruz://?cjk=true&code=true&segmenter=unicode"},
+		// default values are omitted
+		{"trigram://?phrases=true&min-length=3&segmenter=whitespace&cjk=false&code=false", "trigram://"},
+	}
+
+	text := "The Quick_brown fox jumps over the lazy dog, running deriveBucketAndKey"
+
+	for _, test := range tests {
+
+		tokenizer, err := NewTokenizer(ctx, test.uri)
+
+		if err != nil {
+			t.Fatalf("Failed to create tokenizer for %s, %v", test.uri, err)
+		}
+
+		if tokenizer.URI() != test.expected {
+			t.Fatalf("Unexpected URI for %s: %s (expected %s)", test.uri, tokenizer.URI(), test.expected)
+		}
+
+		// the URI creates an equivalent tokenizer
+
+		round_trip, err := NewTokenizer(ctx, tokenizer.URI())
+
+		if err != nil {
+			t.Fatalf("Failed to create tokenizer for %s, %v", tokenizer.URI(), err)
+		}
+
+		if round_trip.URI() != test.expected {
+			t.Fatalf("Unexpected URI for %s: %s (expected %s)", tokenizer.URI(), round_trip.URI(), test.expected)
+		}
+
+		if !slices.Equal(round_trip.Tokenize(text), tokenizer.Tokenize(text)) || round_trip.Normalize(text) != tokenizer.Normalize(text) {
+			t.Fatalf("Tokenizer for %s is not equivalent to the tokenizer for %s", tokenizer.URI(), test.uri)
+		}
+	}
+}
+
+func TestArchiveTokenizerURI(t *testing.T) {
+
+	ctx := context.Background()
+
+	uris := []string{
+		"trigram://?phrases=false",
+		"merovius://?segmenter=unicode",
+		"trigram://?cjk=true&code=true&fold=accents&normalize=nfkc",
+		"jamesrom://?min-length=2",
+		"trigram://?stem=en&stopwords=en",
+	}
+
+	for _, format := range []string{ArchiveFormatJSON, ArchiveFormatBinary} {
+
+		for _, uri := range uris {
+
+			tokenizer, err := NewTokenizer(ctx, uri)
+
+			if err != nil {
+				t.Fatalf("Failed to create tokenizer for %s, %v", uri, err)
+			}
+
+			opts := DefaultIndexOptions()
+			opts.Tokenizer = tokenizer
+			opts.ArchiveFormat = format
+
+			archive := newTestArchive(t, opts, map[string]string{
+				"a.txt": "running in Tokyo, deriveBucketAndKey",
+			})
+
+			// the imported index uses the tokenizer recorded in the archive rather than its own
+
+			imported := NewIndex()
+
+			err = imported.ImportArchive(ctx, archive)
+
+			if err != nil {
+				t.Fatalf("Failed to import %s archive for %s, %v", format, uri, err)
+			}
+
+			if imported.Tokenizer().URI() != uri {
+				t.Fatalf("Unexpected tokenizer for %s archive: %s (expected %s)", format, imported.Tokenizer().URI(), uri)
+			}
+
+			if !slices.Equal(imported.Tokenize("running in Tokyo, deriveBucketAndKey"), tokenizer.Tokenize("running in Tokyo, deriveBucketAndKey")) {
+				t.Fatalf("Tokenizer for %s archive is not equivalent to %s", format, uri)
+			}
+		}
+	}
+}
+
+func TestTokenizeMinLength(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		uri      string
+		text     string
+		expected []string
+		excluded []string
+	}{
+		{"trigram://?phrases=false", "Go is fun", []string{"fun"}, []string{"go", "is", "g", "fu"}},
+		{"trigram://?phrases=false&min-length=2", "Go is fun", []string{"go", "is", "fu", "un", "fun"}, []string{"g", "i", "f"}},
+		{"trigram://?phrases=false&min-length=1", "Go is fun", []string{"g", "o", "i", "s", "f", "u", "n", "go", "is", "fu", "un", "fun"}, []string{}},
+		// short tokens are derived from the (normalized) characters, not bytes
+		{"trigram://?phrases=false&min-length=2", "Éte", []string{"ét", "te", "éte"}, []string{}},
+		{"jamesrom://?phrases=false&min-length=2", "Go is fun", []string{"go", "is", "fu", "un", "fun"}, []string{"g"}},
+	}
+
+	for _, test := range tests {
+
+		tokenizer, err := NewTokenizer(ctx, test.uri)
+
+		if err != nil {
+			t.Fatalf("Failed to create tokenizer for %s, %v", test.uri, err)
+		}
+
+		tokens := tokenizer.Tokenize(test.text)
+
+		for _, token := range test.expected {
+
+			if !slices.Contains(tokens, token) {
+				t.Fatalf("Expected token '%s' for %q using %s, got %q", token, test.text, test.uri, tokens)
+			}
+		}
+
+		for _, token := range test.excluded {
+
+			if slices.Contains(tokens, token) {
+				t.Fatalf("Unexpected token '%s' for %q using %s, got %q", token, test.text, test.uri, tokens)
+			}
+		}
+	}
+
+	for _, uri := range []string{"trigram://?min-length=0", "trigram://?min-length=4", "trigram://?min-length=two"} {
+
+		_, err := NewTokenizer(ctx, uri)
+
+		if err == nil {
+			t.Fatalf("Expected error creating tokenizer for %s", uri)
+		}
+	}
+}
+
+func TestSearchQueryMinLength(t *testing.T) {
+
+	files := map[string]string{
+		"a.txt": "go is fun",
+		"b.txt": "golang rocks",
+		"c.txt": "python",
+	}
+
+	node, err := ParseQuery("go")
+
+	if err != nil {
+		t.Fatalf("Failed to parse query, %v", err)
+	}
+
+	tests := map[string][]uint32{
+		// terms shorter than 3 characters can't be used to rule out documents by default
+		"trigram://":              {0, 1, 2},
+		"trigram://?min-length=2": {0, 1},
+		"trigram://?min-length=1": {0, 1},
+	}
+
+	for uri, expected := range tests {
+
+		tokenizer, err := NewTokenizer(context.Background(), uri)
+
+		if err != nil {
+			t.Fatalf("Failed to create tokenizer for %s, %v", uri, err)
+		}
+
+		opts := DefaultIndexOptions()
+		opts.Tokenizer = tokenizer
+
+		idx, _ := newTestIndex(t, opts, files)
+
+		ids, err := idx.SearchQuery(node)
+
+		if err != nil {
+			t.Fatalf("Failed to search query using %s, %v", uri, err)
+		}
+
+		if !slices.Equal(ids, expected) {
+			t.Fatalf("Unexpected candidates using %s: %v (expected %v)", uri, ids, expected)
+		}
+
+		// verified results are the same regardless of the minimum token length
+
+		paths := queryPaths(t, idx, "go")
+
+		if !slices.Equal(paths, []string{"a.txt", "b.txt"}) {
+			t.Fatalf("Unexpected results using %s: %v", uri, paths)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+
+	"gocloud.dev/blob"
+)
+
+// Update re-walks 'bucket_uris' and rebuilds the index such that only objects which are new or which have changed
+// (as determined by their size, modification time and MD5 hash) since they were last indexed are read and tokenized.
+// The bloom filter data for unchanged objects is copied from the existing index. Objects which no longer exist are
+// removed from the index. Documents associated with buckets not listed in 'bucket_uris' are preserved. If 'bucket_uris'
+// is empty then all the buckets known to the index will be updated.
+//
+// Documents marked as deleted (see `Remove`) are dropped from the index although they will be re-indexed if the
+// corresponding objects still exist in a bucket being updated. Documents without a file record (see `Add`) are also
+// dropped. Document ids are not stable across updates.
+func (idx *Index) Update(ctx context.Context, bucket_uris ...string) error {
+
+	idx.writerMu.Lock()
+	defer idx.writerMu.Unlock()
+
+	if len(bucket_uris) == 0 {
+
+		for uri := range idx.bucketURIs {
+			bucket_uris = append(bucket_uris, uri)
+		}
+	}
+
+	update_ids := make(map[uint32]bool)
+
+	for _, uri := range bucket_uris {
+
+		bucket_id := idx.bucketId(uri)
+		update_ids[bucket_id] = true
+	}
+
+	previous := make(map[string]uint32)
+
+	for id, f := range idx.idToFile {
+
+		if idx.tombstones[uint32(id)] {
+			continue
+		}
+
+		previous[fileKey(f.BucketId, f.Path)] = uint32(id)
+	}
+
+	updated := idx.emptyCopy()
+
+	// First, copy all the documents for buckets which are not being updated
+
+	for id, f := range idx.idToFile {
+
+		if update_ids[f.BucketId] || idx.tombstones[uint32(id)] {
+			continue
+		}
+
+		doc := &indexedDocument{
+			item: idx.documentBits(uint32(id)),
+			file: f,
+		}
+
+		err := updated.addDocument(doc)
+
+		if err != nil {
+			return fmt.Errorf("Failed to copy document %d, %w", id, err)
+		}
+	}
+
+	// Now walk each bucket being updated
+
+	for _, uri := range bucket_uris {
+
+		bucket_id := idx.bucketURIs[uri]
+
+		b, err := idx.openBucket(ctx, uri)
+
+		if err != nil {
+			return fmt.Errorf("Failed to open bucket for '%s', %w", uri, err)
+		}
+
+		p := newIndexPipeline(ctx, updated, idx.workers)
+
+		walk_cb := func(ctx context.Context, obj *blob.ListObject) error {
+
+			id, exists := previous[fileKey(bucket_id, obj.Key)]
+
+			if exists && idx.idToFile[id].Unchanged(obj) {
+
+				job := func(ctx context.Context) (*indexedDocument, error) {
+
+					doc := &indexedDocument{
+						item: idx.documentBits(id),
+						file: idx.idToFile[id],
+					}
+
+					return doc, nil
+				}
+
+				return p.Submit(job)
+			}
+
+			job := func(ctx context.Context) (*indexedDocument, error) {
+				return idx.readDocument(ctx, b, bucket_id, obj)
+			}
+
+			return p.Submit(job)
+		}
+
+		err = idx.walkBucket(p.Context(), b, walk_cb)
+		wait_err := p.Wait()
+
+		if wait_err != nil {
+			return fmt.Errorf("Failed to update bucket '%s', %w", uri, wait_err)
+		}
+
+		if err != nil {
+			return fmt.Errorf("Failed to update bucket '%s', %w", uri, err)
+		}
+	}
+
+	idx.swap(updated)
+	return nil
+}
+
+// swap replaces the documents (bloom filter data, file lookup tables and tombstones) in 'idx' with those in 'other'. Since
+// documents are renumbered this starts a new generation of the index.
+func (idx *Index) swap(other *Index) {
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.bloomFilter = other.bloomFilter
+	idx.idToFile = other.idToFile
+	idx.tombstones = other.tombstones
+	idx.currentDocumentCount = other.currentDocumentCount
+	idx.currentBlockDocumentCount = other.currentBlockDocumentCount
+	idx.currentBlockStartDocumentCount = other.currentBlockStartDocumentCount
+	idx.generation += 1
+}
+
+// emptyCopy returns a new (and empty) `Index` instance with the same configuration as 'idx'.
+func (idx *Index) emptyCopy() *Index {
+
+	opts := &IndexOptions{
+		Tokenizer:     idx.tokenizer,
+		Synonyms:      idx.synonyms,
+		BloomSize:     idx.bloomSize,
+		BloomHashes:   idx.bloomHashes,
+		TermTable:     idx.termTable,
+		MaxBytes:      idx.maxBytes,
+		IgnoreFiles:   idx.ignoreFiles,
+		IncludeHidden: idx.includeHidden,
+		ArchiveFormat: idx.archiveFormat,
+		Workers:       idx.workers,
+	}
+
+	new_idx := NewIndexWithOptions(opts)
+	new_idx.include = idx.include
+	new_idx.exclude = idx.exclude
+
+	return new_idx
+}
+
+// documentBits returns the bloom filter bits for the document 'id' in the same form that `Add` accepts them.
+func (idx *Index) documentBits(id uint32) []bool {
+
+	item := make([]bool, idx.bloomSize)
+
+	offset := (int(id) / DocumentsPerBlock) * idx.bloomSize
+	mask := uint64(1) << (id % DocumentsPerBlock)
+
+	for i := 0; i < idx.bloomSize; i++ {
+		item[i] = idx.bloomFilter[offset+i]&mask != 0
+	}
+
+	return item
+}
+
+func fileKey(bucket_id uint32, path string) string {
+	return fmt.Sprintf("%d#%s", bucket_id, path)
+}
@@ -0,0 +1,141 @@
+package indexer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bucketPath returns the local path of 'name' in the (file://) bucket 'uri'.
+func bucketPath(uri string, name string) string {
+	return filepath.Join(filepath.FromSlash(strings.TrimPrefix(uri, "file://")), filepath.FromSlash(name))
+}
+
+func TestUpdate(t *testing.T) {
+
+	ctx := context.Background()
+
+	idx, uri := newTestIndex(t, DefaultIndexOptions(), map[string]string{
+		"a.txt": "hello world",
+		"b.txt": "goodbye world",
+		"c.txt": "hello again",
+	})
+
+	other_uri := newTestBucket(t, map[string]string{
+		"d.txt": "hello moon",
+	})
+
+	err := idx.IndexBuckets(ctx, other_uri)
+
+	if err != nil {
+		t.Fatalf("Failed to index %s, %v", other_uri, err)
+	}
+
+	// mark the bloom filter bits for "zebra" in the (unchanged) document a.txt so that we can tell whether its
+	// bloom filter data was copied rather than the file being read again
+
+	for _, b := range idx.Queryise("zebra") {
+		idx.bloomFilter[b] |= 1
+	}
+
+	// a.txt is unchanged, b.txt is modified, c.txt is deleted and e.txt is new
+
+	err = os.WriteFile(bucketPath(uri, "b.txt"), []byte("goodbye cruel world"), 0644)
+
+	if err != nil {
+		t.Fatalf("Failed to modify b.txt, %v", err)
+	}
+
+	later := time.Now().Add(time.Hour)
+
+	err = os.Chtimes(bucketPath(uri, "b.txt"), later, later)
+
+	if err != nil {
+		t.Fatalf("Failed to change modification time of b.txt, %v", err)
+	}
+
+	err = os.Remove(bucketPath(uri, "c.txt"))
+
+	if err != nil {
+		t.Fatalf("Failed to delete c.txt, %v", err)
+	}
+
+	err = os.WriteFile(bucketPath(uri, "e.txt"), []byte("hello sun"), 0644)
+
+	if err != nil {
+		t.Fatalf("Failed to write e.txt, %v", err)
+	}
+
+	// adding a file to a bucket which isn't updated has no effect
+
+	err = os.WriteFile(bucketPath(other_uri, "f.txt"), []byte("hello stars"), 0644)
+
+	if err != nil {
+		t.Fatalf("Failed to write f.txt, %v", err)
+	}
+
+	err = idx.Update(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to update index, %v", err)
+	}
+
+	if idx.Statistics().Documents != 4 {
+		t.Fatalf("Unexpected number of documents after update: %d", idx.Statistics().Documents)
+	}
+
+	// documents for buckets which aren't updated are copied first
+
+	if idx.IdToFile(0).Path != "d.txt" || idx.bucketURI(idx.IdToFile(0).BucketId) != other_uri {
+		t.Fatalf("Expected d.txt to be preserved as document 0, got %v", idx.IdToFile(0))
+	}
+
+	tests := map[string][]string{
+		"hello":          {"d.txt", "a.txt", "e.txt"},
+		"world":          {"a.txt", "b.txt"},
+		`"cruel world"`:  {"b.txt"},
+		"again":          {},
+		"moon":           {"d.txt"},
+		"sun":            {"e.txt"},
+		"stars":          {},
+		"goodbye -cruel": {},
+	}
+
+	for q, expected := range tests {
+
+		paths := queryPaths(t, idx, q)
+
+		if !slices.Equal(paths, expected) {
+			t.Fatalf("Unexpected results for '%s' after update: %v (expected %v)", q, paths, expected)
+		}
+	}
+
+	// the bloom filter data for a.txt was copied from the existing index
+
+	ids := idx.Search(idx.Queryise("zebra"))
+
+	if !slices.Equal(ids, []uint32{1}) || idx.IdToFile(1).Path != "a.txt" {
+		t.Fatalf("Expected bloom filter data for a.txt to be copied, got %v", ids)
+	}
+
+	// updating every bucket adds f.txt
+
+	err = idx.Update(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to update index, %v", err)
+	}
+
+	// the order in which buckets are updated is not defined
+
+	paths := queryPaths(t, idx, "hello")
+	slices.Sort(paths)
+
+	if !slices.Equal(paths, []string{"a.txt", "d.txt", "e.txt", "f.txt"}) {
+		t.Fatalf("Unexpected results after updating every bucket: %v", paths)
+	}
+}
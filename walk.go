@@ -0,0 +1,137 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strings"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+// walkBucket crawls 'b' and invokes 'cb' for each file it encounters which is not excluded by the include
+// and exclude rules defined in the index options, any ignore files found while crawling or, unless hidden
+// files are explicitly included, because it is contained by a directory whose name starts with ".".
+//
+// This is a variation of the `WalkBucket` method in aaronland/gocloud-blob/walk which needs to know about
+// directories (in order to prune them) before they are crawled.
+func (idx *Index) walkBucket(ctx context.Context, b *blob.Bucket, cb walkCallback) error {
+
+	var list func(context.Context, string, ignoreRules) error
+
+	list = func(ctx context.Context, prefix string, rules ignoreRules) error {
+
+		dir_rules, err := idx.loadIgnoreRules(ctx, b, prefix)
+
+		if err != nil {
+			return fmt.Errorf("Failed to load ignore rules for %s, %w", prefix, err)
+		}
+
+		if len(dir_rules) > 0 {
+			rules = append(append(ignoreRules{}, rules...), dir_rules...)
+		}
+
+		iter := b.List(&blob.ListOptions{
+			Delimiter: "/",
+			Prefix:    prefix,
+		})
+
+		for {
+			obj, err := iter.Next(ctx)
+
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				return fmt.Errorf("Failed to iterate next in bucket for %s, %w", prefix, err)
+			}
+
+			rel_path := strings.TrimRight(obj.Key, "/")
+
+			if obj.IsDir {
+
+				if !idx.includeHidden && strings.HasPrefix(path.Base(rel_path), ".") {
+					continue
+				}
+
+				if idx.exclude.Match(rel_path, true) || rules.Match(rel_path, true) {
+					continue
+				}
+
+				err := list(ctx, obj.Key, rules)
+
+				if err != nil {
+					return fmt.Errorf("Failed to list bucket for %s, %w", obj.Key, err)
+				}
+
+				continue
+			}
+
+			if idx.exclude.Match(rel_path, false) || rules.Match(rel_path, false) {
+				continue
+			}
+
+			if len(idx.include) > 0 && !idx.include.Match(rel_path, false) {
+				continue
+			}
+
+			err = cb(ctx, obj)
+
+			if err != nil {
+				return fmt.Errorf("Callback function for %s returned an error, %w", obj.Key, err)
+			}
+		}
+
+		return nil
+	}
+
+	err := list(ctx, "", ignoreRules{})
+
+	if err != nil {
+		return fmt.Errorf("Failed to walk bucket, %w", err)
+	}
+
+	return nil
+}
+
+// walkCallback is a custom function for processing a `blob.ListObject` instance, used by the `walkBucket` method.
+type walkCallback func(context.Context, *blob.ListObject) error
+
+// loadIgnoreRules reads and parses any ignore files (for example .gitignore) that the index has been configured
+// to honour in the directory 'prefix' of 'b'.
+func (idx *Index) loadIgnoreRules(ctx context.Context, b *blob.Bucket, prefix string) (ignoreRules, error) {
+
+	rules := make(ignoreRules, 0)
+
+	for _, fname := range idx.ignoreFiles {
+
+		key := prefix + fname
+
+		r, err := b.NewReader(ctx, key, nil)
+
+		if err != nil {
+
+			if gcerrors.Code(err) == gcerrors.NotFound {
+				continue
+			}
+
+			slog.Warn("Failed to open ignore file for reading", "path", key, "error", err)
+			continue
+		}
+
+		file_rules, err := parseIgnoreRules(r, prefix)
+		r.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse %s, %w", key, err)
+		}
+
+		rules = append(rules, file_rules...)
+	}
+
+	return rules, nil
+}